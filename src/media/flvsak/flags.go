@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"media/sak"
+	"strconv"
+	"strings"
+)
+
+// comma separated keys
+type csKeys []string
+
+// key=value1|value2, comma separated
+type saMeta map[string][]string
+
+// comma separated, map tag type to string
+type csTTS map[flv.TagType]string
+
+// comma separated, map tag type to int
+type csTTI map[flv.TagType]int
+
+// comma separated ranges
+type csRanges [][2]int
+
+// key[:type]=value, repeated flag sets several keys
+type kvMeta map[string]interface{}
+
+func (i *csKeys) String() string {
+	return fmt.Sprint(*i)
+}
+
+func (i *csKeys) Set(value string) error {
+	for _, mk := range strings.Split(value, ",") {
+		*i = append(*i, mk)
+	}
+	return nil
+}
+
+func (i *csTTS) String() string {
+	out := make([]string, 0)
+	for k, v := range *i {
+		out = append(out, fmt.Sprintf("%s:%s", k, v))
+	}
+	return strings.Join(out, ",")
+}
+
+func (i *csTTS) Set(value string) error {
+	for _, mk := range strings.Split(value, ",") {
+
+		ts := strings.Split(mk, ":")
+		if len(ts) != 2 {
+			return fmt.Errorf("bad content spec: %s", mk)
+		}
+		switch ts[0] {
+		case "video":
+			(*i)[flv.TAG_TYPE_VIDEO] = ts[1]
+		case "audio":
+			(*i)[flv.TAG_TYPE_AUDIO] = ts[1]
+		case "meta":
+			(*i)[flv.TAG_TYPE_META] = ts[1]
+		default:
+			return fmt.Errorf("bad content type: %s", ts[0])
+		}
+	}
+	return nil
+}
+
+func (i *csTTI) String() string {
+	out := make([]string, 0)
+	for k, v := range *i {
+		var app string
+		if v == -1 {
+			app = "all"
+		} else {
+			app = strconv.Itoa(v)
+		}
+		out = append(out, fmt.Sprintf("%s:%s", k, app))
+	}
+	return strings.Join(out, ",")
+}
+
+func (i *csTTI) Set(value string) error {
+	for _, mk := range strings.Split(value, ",") {
+
+		ts := strings.Split(mk, ":")
+		if len(ts) != 2 {
+			return fmt.Errorf("bad stream spec: %s", mk)
+		}
+		var id int
+		if ts[1] == "all" {
+			id = -1
+		} else {
+			var err error
+			id, err = strconv.Atoi(ts[1])
+			if err != nil {
+				return fmt.Errorf("bad stream id %s: %s", ts[1], err)
+			}
+		}
+		switch ts[0] {
+		case "video":
+			(*i)[flv.TAG_TYPE_VIDEO] = id
+		case "audio":
+			(*i)[flv.TAG_TYPE_AUDIO] = id
+		case "meta":
+			(*i)[flv.TAG_TYPE_META] = id
+		default:
+			return fmt.Errorf("bad content type: %s", ts[0])
+		}
+	}
+	return nil
+}
+
+func (i *csRanges) String() string {
+	out := make([]string, 0)
+	for _, v := range *i {
+		out = append(out, fmt.Sprintf("[%d..%d]", v[0], v[1]))
+	}
+	return strings.Join(out, ",")
+}
+
+func (i *csRanges) Set(value string) error {
+	for _, mk := range strings.Split(value, ",") {
+		ts := strings.Split(mk, "..")
+		var start, stop int
+		var err error
+		start, err = strconv.Atoi(ts[0])
+		if err != nil {
+			return fmt.Errorf("bad range %s: %s", value, err)
+		}
+		if len(ts) == 1 {
+			stop = start
+		} else if len(ts) == 2 {
+			stop, err = strconv.Atoi(ts[1])
+			if err != nil {
+				return fmt.Errorf("bad range %s: %s", value, err)
+			}
+		} else {
+			return fmt.Errorf("bad range: %s", mk)
+		}
+		(*i) = append((*i), [2]int{start, stop})
+	}
+	return nil
+}
+
+func (i *saMeta) String() string {
+	return fmt.Sprintf("%v", (*i))
+}
+
+func (i *saMeta) Set(value string) error {
+	for _, mk := range strings.Split(value, ",") {
+		ts := strings.Split(mk, "=")
+		if len(ts) != 2 {
+			return fmt.Errorf("bad metadata spec: %s", mk)
+		}
+		(*i)[ts[0]] = strings.Split(ts[1], "|")
+	}
+	return nil
+}
+
+func (i *kvMeta) String() string {
+	return fmt.Sprint(map[string]interface{}(*i))
+}
+
+func (i *kvMeta) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("bad metadata value %s, want key[:type]=value", value)
+	}
+	// suffix is type only if it names one, keys may have colons themselves
+	key, typ := kv[0], ""
+	if n := strings.LastIndex(key, ":"); n >= 0 {
+		switch t := key[n+1:]; t {
+		case sak.MetaString, sak.MetaNumber, sak.MetaBoolean, sak.MetaDate, sak.MetaObject, sak.MetaArray:
+			key, typ = key[:n], t
+		}
+	}
+	v, err := sak.ParseMetaValue(typ, kv[1])
+	if err != nil {
+		return fmt.Errorf("bad value of %s: %s", key, err)
+	}
+	if *i == nil {
+		*i = make(kvMeta)
+	}
+	(*i)[key] = v
+	return nil
+}
+
+// comma separated tag types
+type csTagTypes []flv.TagType
+
+// comma separated stream ids
+type csStreams []uint32
+
+func (i *csTagTypes) String() string {
+	return fmt.Sprint(*i)
+}
+
+func (i *csTagTypes) Set(value string) error {
+	for _, mk := range strings.Split(value, ",") {
+		switch mk {
+		case "video":
+			*i = append(*i, flv.TAG_TYPE_VIDEO)
+		case "audio":
+			*i = append(*i, flv.TAG_TYPE_AUDIO)
+		case "meta":
+			*i = append(*i, flv.TAG_TYPE_META)
+		default:
+			return fmt.Errorf("bad content type: %s", mk)
+		}
+	}
+	return nil
+}
+
+func (i *csStreams) String() string {
+	return fmt.Sprint(*i)
+}
+
+func (i *csStreams) Set(value string) error {
+	for _, mk := range strings.Split(value, ",") {
+		id, err := strconv.ParseUint(mk, 10, 24)
+		if err != nil {
+			return fmt.Errorf("bad stream id %s: %s", mk, err)
+		}
+		*i = append(*i, uint32(id))
+	}
+	return nil
+}
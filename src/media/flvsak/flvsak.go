@@ -1,983 +1,573 @@
 package main
 
 import (
-	"bytes"
+	"errors"
 	"flag"
 	"fmt"
-	"github.com/metachord/amf.go/amf0"
 	"github.com/metachord/flv.go/flv"
 	"log"
-	"math"
+	"media/sak"
 	"os"
-	"sort"
-	"strconv"
 	"strings"
-	"time"
 )
 
-var inFile string
-var outFile string
-
-var printInfo bool
-
-var flvDump bool
-var minDts, maxDts int
-
-// comma separated keys
-type csKeys []string
-
-var printInfoKeys csKeys
-
-type saMeta map[string][]string
-var skipMeta saMeta
-
-var isConcat bool
-var inFiles csKeys
-
-var readRecover bool
-var maxScanSize int
-
-var verbose bool
-
-var updateKeyframes bool
-
-var splitContent bool
-
-var splitStreams bool
-var splitStreamsStopAfter int
-var splitStreamsMinimalDuration int
-
-// comma separated, map tag type to string
-type csTTS map[flv.TagType]string
-
-var outcFiles csTTS
-
-// comma separated, map tag type to int
-type csTTI map[flv.TagType]int
-
-var streams csTTI
-
-// comma separated ranges
-type csRanges [][2]int
-
-var crop csRanges
-var cropIdx int = 0
-var cropActive bool = false
-var cropWaitKeyframe bool
-
-var fixDts bool
+// command is a flvsak subcommand with its own flags.
+type command struct {
+	name    string
+	args    string
+	summary string
+	// setup registers flags of command and returns function to run it
+	// after flags are parsed.
+	setup func(fs *flag.FlagSet, opts *sak.Options) func() error
+}
 
-var scaleDts float64 = 1.0
+var commands = []*command{
+	{"info", "-in in_file.flv [-keys key1,key2 | -report | -verify-index] [-format text|json|yaml|xml] | [-columns c1,c2] [-workers N] [-format text|csv|jsonl] file|dir|glob ...", "print metadata regenerated from file, verify metadata of file or print row per file", setupInfo},
+	{"dump", "-in in_file.flv [-min-dts INT] [-max-dts INT [-stop-past-max-dts MS]] [-type video,audio,meta] [-stream ID,...] [-keyframes | -sequence-headers] [-event NAME,...] [-min-offset INT] [-max-offset INT] [-min-index INT] [-max-index INT] [-n N] [-payload N] [-format text|jsonl|csv | -format framehash [-hash md5|sha256] [-ignore-timestamps]]", "dump frames or their checksums", setupDump},
+	{"find", "-in in_file.flv [-out out_file.flv] [-n N] [-payload N] [-format text|jsonl|csv] EXPRESSION", "print or extract tags matching expression", setupFind},
+	{"crop", "-in in_file.flv -out out_file.flv -crop RANGES [-crop-wait-keyframe]", "crop ranges of dts", setupCrop},
+	{"split", "-in in_file.flv (-outc type:file,... | -out out_file.flv) [-streams type:id,...] [-split-streams]", "split content and streams to different files", setupSplit},
+	{"concat", "-out out_file.flv in_file1.flv in_file2.flv ...", "concat files with the same codec", setupConcat},
+	{"fix", "-in in_file.flv -out out_file.flv [-fix-dts] [-scale-dts FLOAT] [-skip-meta key=v1|v2]", "copy file fixing dts and dropping frames", setupFix},
+	{"meta", "-in in_file.flv (-out out_file.flv [-reserve-padding N] | -in-place) [-cue-points cues.json] [-meta-set key[:type]=value] [-meta-delete key]", "update keyframes and other metadata", setupMeta},
+}
 
-var compensateDts bool
+// Exit codes by class of error.
+const (
+	exitFailure  = 1
+	exitUsage    = 2
+	exitInput    = 3
+	exitOutput   = 4
+	exitMetadata = 5
+)
 
-func (i *csKeys) String() string {
-	return fmt.Sprint(*i)
+func exitCode(err error) int {
+	var (
+		oerr *sak.OptionsError
+		ierr *sak.InputError
+		werr *sak.OutputError
+		merr *sak.MetadataError
+	)
+	switch {
+	case errors.As(err, &oerr):
+		return exitUsage
+	case errors.As(err, &ierr):
+		return exitInput
+	case errors.As(err, &werr):
+		return exitOutput
+	case errors.As(err, &merr):
+		return exitMetadata
+	}
+	return exitFailure
 }
 
-func (i *csKeys) Set(value string) error {
-	for _, mk := range strings.Split(value, ",") {
-		*i = append(*i, mk)
-	}
-	return nil
+// usageError is reported with usage of command and exit code 2.
+type usageError struct {
+	msg string
 }
 
-func (i *csTTS) String() string {
-	out := make([]string, 0)
-	for k, v := range *i {
-		out = append(out, fmt.Sprintf("%s:%s", k, v))
-	}
-	return strings.Join(out, ",")
+func (e *usageError) Error() string {
+	return e.msg
 }
 
-func (i *csTTS) Set(value string) error {
-	for _, mk := range strings.Split(value, ",") {
-
-		ts := strings.Split(mk, ":")
-		switch ts[0] {
-		case "video":
-			(*i)[flv.TAG_TYPE_VIDEO] = ts[1]
-		case "audio":
-			(*i)[flv.TAG_TYPE_AUDIO] = ts[1]
-		case "meta":
-			(*i)[flv.TAG_TYPE_META] = ts[1]
-		default:
-			log.Fatalf("Bad content type: %s", ts[0])
-		}
-	}
-	return nil
+func usagef(format string, v ...interface{}) error {
+	return &usageError{fmt.Sprintf(format, v...)}
 }
 
-func (i *csTTI) String() string {
-	out := make([]string, 0)
-	for k, v := range *i {
-		var app string
-		if v == -1 {
-			app = "all"
-		} else {
-			app = strconv.Itoa(v)
-		}
-		out = append(out, fmt.Sprintf("%s:%s", k, app))
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s command [options]\n\ncommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.summary)
 	}
-	return strings.Join(out, ",")
+	fmt.Fprintf(os.Stderr, "\nRun '%s help command' for options of command.\n", os.Args[0])
 }
 
-func (i *csTTI) Set(value string) error {
-	for _, mk := range strings.Split(value, ",") {
-
-		ts := strings.Split(mk, ":")
-		switch ts[0] {
-		case "video":
-			(*i)[flv.TAG_TYPE_VIDEO], _ = strconv.Atoi(ts[1])
-		case "audio":
-			(*i)[flv.TAG_TYPE_AUDIO], _ = strconv.Atoi(ts[1])
-		case "meta":
-			(*i)[flv.TAG_TYPE_META], _ = strconv.Atoi(ts[1])
-		default:
-			log.Fatalf("Bad content type: %s", ts[0])
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
 		}
 	}
 	return nil
 }
 
-func (i *csRanges) String() string {
-	out := make([]string, 0)
-	for _, v := range *i {
-		out = append(out, fmt.Sprintf("[%d..%d]", v[0], v[1]))
+func newFlagSet(c *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s %s %s\n\n%s.\n\noptions:\n", os.Args[0], c.name, c.args, c.summary)
+		fs.PrintDefaults()
 	}
-	return strings.Join(out, ",")
+	return fs
 }
 
-func (i *csRanges) Set(value string) error {
-	for _, mk := range strings.Split(value, ",") {
-		ts := strings.Split(mk, "..")
-		var start, stop int
-		var err error
-		start, err = strconv.Atoi(ts[0])
-		if err != nil {
-			log.Fatalf("Bad range %s: %s", value, err)
-		}
-		if len(ts) == 1 {
-			stop = start
-		} else if len(ts) == 2 {
-			stop, err = strconv.Atoi(ts[1])
-			if err != nil {
-				log.Fatal("Bad range %s: %s", value, err)
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	name, args := os.Args[1], os.Args[2:]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		if len(args) > 0 {
+			if c := findCommand(args[0]); c != nil {
+				fs := newFlagSet(c)
+				opts := sak.DefaultOptions()
+				commonFlags(fs, &opts)
+				c.setup(fs, &opts)
+				fs.Usage()
+				return
 			}
-		} else {
-			log.Fatalf("Bad range: %s", mk)
 		}
-		(*i) = append((*i), [2]int{start, stop})
+		usage()
+		return
 	}
-	return nil
-}
 
+	c := findCommand(name)
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "%s: unknown command %q\n", os.Args[0], name)
+		usage()
+		os.Exit(exitUsage)
+	}
 
+	opts := sak.DefaultOptions()
+	opts.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	fs := newFlagSet(c)
+	commonFlags(fs, &opts)
+	run := c.setup(fs, &opts)
 
-func (i *saMeta) String() string {
-	return fmt.Sprintf("%v", (*i))
-}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return
+		}
+		os.Exit(exitUsage)
+	}
+	if opts.MaxScanSize != 0 && !opts.Recover {
+		err := usagef("-recover-scan-length requires -recover")
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", os.Args[0], c.name, err)
+		os.Exit(exitUsage)
+	}
 
-func (i *saMeta) Set(value string) error {
-	fmt.Printf("Value: %v", value)
-	for _, mk := range strings.Split(value, ",") {
-		log.Printf("%v", mk)
-		ts := strings.Split(mk, "=")
-		(*i)[ts[0]] = strings.Split(ts[1], "|")
+	if err := run(); err != nil {
+		if _, ok := err.(*usageError); ok {
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", os.Args[0], c.name, err)
+			fs.Usage()
+			os.Exit(exitUsage)
+		}
+		log.Print(err)
+		os.Exit(exitCode(err))
 	}
-	return nil
 }
 
-func init() {
-
-	outcFiles = make(csTTS)
-	outcFiles[flv.TAG_TYPE_VIDEO] = ""
-	outcFiles[flv.TAG_TYPE_AUDIO] = ""
-	outcFiles[flv.TAG_TYPE_META] = ""
-
-	streams = make(csTTI)
-	streams[flv.TAG_TYPE_VIDEO] = -1
-	streams[flv.TAG_TYPE_AUDIO] = -1
-	streams[flv.TAG_TYPE_META] = -1
-
-	crop = make(csRanges, 0)
-
-	skipMeta = make(saMeta, 0)
-
-
-	flag.StringVar(&inFile, "in", "", "input file")
-	flag.StringVar(&outFile, "out", "", "output file")
-
-	flag.BoolVar(&readRecover, "recover", false, "recoverable read")
-	flag.IntVar(&maxScanSize, "recover-scan-length", 0, "max interval to look for valid frame during recovery")
-
-	flag.BoolVar(&printInfo, "info", false, "print file info")
-	flag.BoolVar(&flvDump, "dump", false, "dump frames")
-	flag.IntVar(&minDts, "min-dts", -1, "dump from dts")
-	flag.IntVar(&maxDts, "max-dts", -1, "dump to dts")
-	flag.Var(&printInfoKeys, "info-keys", "print info from metadata for keys (comma separated)")
-	flag.BoolVar(&verbose, "verbose", false, "be verbose")
-
-	flag.BoolVar(&updateKeyframes, "update-keyframes", false, "update keyframes positions in metatag")
-
-	flag.BoolVar(&splitContent, "split-content", false, "split content to different files")
-
-	flag.BoolVar(&splitStreams, "split-streams", false, "split streams to different files")
-	flag.IntVar(&splitStreamsMinimalDuration, "split-streams-minimal-duration", 5000, "minimal duration of file in milliseconds")
-	flag.IntVar(&splitStreamsStopAfter, "split-streams-stop-after", 5000, "stop file writing ")
-
-	flag.Var(&outcFiles, "outc", "output frames of declared type to destination")
-
-	flag.BoolVar(&isConcat, "concat", false, "concat files with the same codec")
-	flag.Var(&inFiles, "ins", "input files")
-
-	flag.Var(&streams, "streams", "store stream of declared type specified this id (default all)")
-
-	flag.Var(&crop, "crop", "crop specified ranges of dts")
-	flag.BoolVar(&cropWaitKeyframe, "crop-wait-keyframe", false, "wait video keyframe after cropping")
-	flag.Var(&skipMeta, "skip-meta", "skip specified keys of metadata")
-
-	flag.Float64Var(&scaleDts, "scale-dts", 1.0, "scale dts")
-
-	flag.BoolVar(&fixDts, "fix-dts", false, "fix non monotonically dts")
-	flag.BoolVar(&compensateDts, "compensate-dts", false, "compensate dts for removed streams")
+// commonFlags registers flags accepted by every command.
+func commonFlags(fs *flag.FlagSet, opts *sak.Options) {
+	fs.BoolVar(&opts.Recover, "recover", false, "recoverable read")
+	fs.IntVar(&opts.MaxScanSize, "recover-scan-length", 0, "max interval to look for valid frame during recovery")
+	fs.BoolVar(&opts.Verbose, "verbose", false, "be verbose")
+	fs.BoolVar(&opts.KeepPartial, "keep-partial", false, "keep outputs of failed command")
 }
 
-func usage() {
-	msg := []string{
-		"usage: %s -in in_file.flv",
-		" [-update-keyframes -out out_file.flv]",
-		" [-info] [-info-keys key1,key2,key3]",
-		" [-dump [-min-dts INT] [-max-dts INT]]",
-		" [-verbose]",
-		" [-fix-dts]",
-		" [-split-content [-out-video out_video.flv] [-out-audio out_audio.flv] [-out-meta out_meta.flv]]",
-		" [[-stream-video INT] [-stream-audio INT] [-stream-meta INT] [-compensate-dts]]",
-		"\n",
+// requireFile checks that file flag is set.
+func requireFile(flagName, value string) error {
+	if value == "" {
+		return usagef("-%s is required", flagName)
 	}
-	fmt.Fprintf(os.Stderr, strings.Join(msg, "\n"), os.Args[0])
-	flag.PrintDefaults()
-	os.Exit(2)
+	return nil
 }
 
-type kfTimePos struct {
-	Dts      uint32
-	Position int64
+// noArgs checks that no positional arguments are left after flags.
+func noArgs(fs *flag.FlagSet) error {
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument: %s", fs.Arg(0))
+	}
+	return nil
 }
 
-var commonHeader *flv.Header
-
-type streamWriter struct {
-	fileName string
-	fd *os.File
-	writer *flv.FlvWriter
-	firstDts int
-	lastDts int
-	offsetDts uint32
+func pipelineFlag(fs *flag.FlagSet, opts *sak.Options) {
+	fs.Var((*csKeys)(&opts.Pipeline), "pipeline", fmt.Sprintf("order of frame processing stages (default %s)", strings.Join(sak.DefaultPipeline(), ",")))
 }
 
-var streamsWriters map[uint32]*streamWriter
-var splitFileNumber int
-
-func main() {
-	flag.Usage = usage
-	flag.Parse()
-
-	defer closeSplitWriters()
-
-	if isConcat {
-		concatFiles()
-		return
+func checkPipeline(opts *sak.Options) error {
+nextStage:
+	for _, name := range opts.Pipeline {
+		for _, known := range sak.DefaultPipeline() {
+			if name == known {
+				continue nextStage
+			}
+		}
+		return usagef("unknown pipeline stage: %s", name)
 	}
+	return nil
+}
 
-	if inFile == "" {
-		log.Fatal("No input file")
-	}
+func streamsFlags(fs *flag.FlagSet, opts *sak.Options) {
+	opts.Streams = make(map[flv.TagType]int)
+	fs.Var((*csTTI)(&opts.Streams), "streams", "store stream (or Enhanced RTMP track) of declared type specified this id (default all)")
+	fs.BoolVar(&opts.CompensateDts, "compensate-dts", false, "compensate dts for removed streams")
+}
 
-	inF, err := os.Open(inFile)
-	if err != nil {
-		log.Fatal(err)
+func checkStreams(opts *sak.Options) error {
+	if opts.CompensateDts && len(opts.Streams) == 0 {
+		return usagef("-compensate-dts requires -streams")
 	}
-	defer inF.Close()
+	return nil
+}
 
-	frReader, header, err := openFrameReader(inF)
-	if err != nil {
-		log.Fatal(err)
+func setupInfo(fs *flag.FlagSet, opts *sak.Options) func() error {
+	inFile := fs.String("in", "", "input file")
+	var keys csKeys
+	fs.Var(&keys, "keys", "print info from metadata for keys (comma separated)")
+	verify := fs.Bool("verify-index", false, "check keyframes index, filesize, datasize and duration of onMetaData against the file")
+	report := fs.Bool("report", false, "print FLV header, tags statistics of every stream, script events and onMetaData values differing from the file")
+	fs.StringVar(&opts.Format, "format", sak.FormatText, "output format: text, json, yaml or xml (flvtool2 -P layout, not for -report); for several files text (table), csv or jsonl")
+	var columns csKeys
+	fs.Var(&columns, "columns", "columns of rows for several files (comma separated): "+strings.Join(sak.InventoryColumns(), ","))
+	fs.IntVar(&opts.Workers, "workers", 0, "number of files scanned at once, default is number of CPUs")
+	return func() error {
+		if fs.NArg() > 0 {
+			return runInventory(fs, opts, *inFile, keys, *verify || *report, columns)
+		}
+		if err := requireFile("in", *inFile); err != nil {
+			return err
+		}
+		if len(columns) > 0 {
+			return usagef("-columns needs files, directories or globs as arguments")
+		}
+		switch opts.Format {
+		case sak.FormatText, sak.FormatJSON, sak.FormatYAML, sak.FormatXML:
+		default:
+			return usagef("unknown -format %q", opts.Format)
+		}
+		if *verify {
+			if len(keys) > 0 || opts.Format != sak.FormatText {
+				return usagef("-keys and -format can not be used with -verify-index")
+			}
+			return sak.NewJob(*opts).VerifyIndex(*inFile, os.Stdout)
+		}
+		if *report {
+			if len(keys) > 0 || opts.Format == sak.FormatXML {
+				return usagef("-keys and -format xml can not be used with -report")
+			}
+			job := sak.NewJob(*opts)
+			rep, err := job.Report(*inFile)
+			if err != nil {
+				return err
+			}
+			return job.PrintReport(rep, os.Stdout)
+		}
+		return sak.NewJob(*opts).Info(*inFile, keys, os.Stdout)
 	}
-	commonHeader = header
+}
 
-	if printInfo {
-		printMetaData(frReader, printInfoKeys)
-		return
-	} else if flvDump {
-		createMetaKeyframes(frReader)
-	} else if splitContent {
-		if outcFiles[flv.TAG_TYPE_VIDEO] == "" && outcFiles[flv.TAG_TYPE_AUDIO] == "" && outcFiles[flv.TAG_TYPE_META] == "" {
-			log.Fatal("No any split output file")
-		}
-
-		type splitWriter struct {
-			FileName string
-			Writer   *flv.FlvWriter
-		}
-
-		frFW := make(map[flv.TagType]*splitWriter)
-		frFW[flv.TAG_TYPE_VIDEO] = &splitWriter{FileName: outcFiles[flv.TAG_TYPE_VIDEO], Writer: nil}
-		frFW[flv.TAG_TYPE_AUDIO] = &splitWriter{FileName: outcFiles[flv.TAG_TYPE_AUDIO], Writer: nil}
-		frFW[flv.TAG_TYPE_META] = &splitWriter{FileName: outcFiles[flv.TAG_TYPE_META], Writer: nil}
-
-		frW := make(map[flv.TagType]*flv.FlvWriter)
-
-		for k, _ := range frFW {
-			var of string
-			switch k {
-			case flv.TAG_TYPE_VIDEO:
-				of = outcFiles[flv.TAG_TYPE_VIDEO]
-			case flv.TAG_TYPE_AUDIO:
-				of = outcFiles[flv.TAG_TYPE_AUDIO]
-			case flv.TAG_TYPE_META:
-				of = outcFiles[flv.TAG_TYPE_META]
+func setupDump(fs *flag.FlagSet, opts *sak.Options) func() error {
+	inFile := fs.String("in", "", "input file")
+	fs.IntVar(&opts.MinDts, "min-dts", -1, "dump from dts")
+	fs.IntVar(&opts.MaxDts, "max-dts", -1, "dump to dts")
+	fs.StringVar(&opts.Format, "format", sak.FormatText, "output format: text, jsonl, csv or framehash (checksum of every tag body)")
+	fs.StringVar(&opts.FrameHash, "hash", sak.HashMD5, "checksum of framehash format: md5 or sha256")
+	fs.BoolVar(&opts.FrameHashNoTimestamps, "ignore-timestamps", false, "leave dts out of framehash format")
+	f := &opts.Dump
+	fs.Var((*csTagTypes)(&f.Types), "type", "dump tags of types (comma separated): video, audio, meta")
+	fs.Var((*csStreams)(&f.Streams), "stream", "dump tags of stream ids (comma separated)")
+	fs.BoolVar(&f.Keyframes, "keyframes", false, "dump video keyframes only")
+	fs.BoolVar(&f.SequenceHeaders, "sequence-headers", false, "dump audio and video sequence headers only")
+	fs.Var((*csKeys)(&f.Events), "event", "dump script tags of events (comma separated), e.g. onMetaData")
+	fs.Int64Var(&f.MinOffset, "min-offset", -1, "dump from tag at byte offset")
+	fs.Int64Var(&f.MaxOffset, "max-offset", -1, "dump to tag at byte offset")
+	fs.IntVar(&f.MinIndex, "min-index", -1, "dump from tag index, the first tag is 0")
+	fs.IntVar(&f.MaxIndex, "max-index", -1, "dump to tag index")
+	fs.IntVar(&f.Limit, "n", 0, "stop after dumping N tags")
+	fs.IntVar(&f.StopPastMaxDts, "stop-past-max-dts", -1, "stop reading at the first tag more than that many milliseconds past -max-dts, -1 reads to the end")
+	fs.IntVar(&opts.DumpPayload, "payload", 0, "hex dump N first bytes of tag body with NAL units of AVC and HEVC, AAC frame size and AMF values of script tags")
+	return func() error {
+		if err := requireFile("in", *inFile); err != nil {
+			return err
+		}
+		if err := noArgs(fs); err != nil {
+			return err
+		}
+		switch opts.Format {
+		case sak.FormatText, sak.FormatJSONL, sak.FormatCSV:
+			if opts.FrameHash != sak.HashMD5 || opts.FrameHashNoTimestamps {
+				return usagef("-hash and -ignore-timestamps need -format framehash")
 			}
-
-			var pW *flv.FlvWriter = nil
-			for wk, wv := range frFW {
-				if wv.FileName == of {
-					if wv.Writer != nil {
-						log.Printf("Write %s to existing %s file %s", k, wk, of)
-						pW = wv.Writer
-						break
-					}
-				}
+		case sak.FormatFrameHash:
+			if opts.DumpPayload != 0 {
+				return usagef("-payload can not be used with -format framehash")
 			}
-
-			if pW != nil {
-				frW[k] = pW
-			} else {
-				outF, err := os.Create(of)
-				if err != nil {
-					log.Fatal(err)
-				}
-				log.Printf("Write %s to %s", k, of)
-				frFW[k].Writer = flv.NewWriter(outF)
-				frFW[k].Writer.WriteHeader(header)
-				frW[k] = frFW[k].Writer
+			if opts.FrameHash != sak.HashMD5 && opts.FrameHash != sak.HashSHA256 {
+				return usagef("unknown -hash %q", opts.FrameHash)
 			}
-
+		default:
+			return usagef("unknown -format %q", opts.Format)
 		}
-		for _, v := range frW {
-			defer v.OutFile.Close()
+		if opts.MinDts != -1 && opts.MaxDts != -1 && opts.MinDts > opts.MaxDts {
+			return usagef("-min-dts %d is greater than -max-dts %d", opts.MinDts, opts.MaxDts)
 		}
-		writeFrames(frReader, frW, 0)
-	} else {
-		if outFile == "" {
-			log.Fatal("No output file")
+		if f.MinOffset != -1 && f.MaxOffset != -1 && f.MinOffset > f.MaxOffset {
+			return usagef("-min-offset %d is greater than -max-offset %d", f.MinOffset, f.MaxOffset)
 		}
-
-		outF, err := os.Create(outFile)
-		if err != nil {
-			log.Fatal(err)
+		if f.StopPastMaxDts != -1 && (f.StopPastMaxDts < 0 || opts.MaxDts == -1) {
+			return usagef("-stop-past-max-dts needs -max-dts and milliseconds not less than 0")
 		}
-		defer outF.Close()
-
-		frWriter := flv.NewWriter(outF)
-		frWriter.WriteHeader(header)
-
-		if updateKeyframes {
-			inStart := writeMetaKeyframes(frReader, frWriter)
-			inF.Seek(inStart, os.SEEK_SET)
+		if f.MinIndex != -1 && f.MaxIndex != -1 && f.MinIndex > f.MaxIndex {
+			return usagef("-min-index %d is greater than -max-index %d", f.MinIndex, f.MaxIndex)
 		}
-
-		frW := make(map[flv.TagType]*flv.FlvWriter)
-		frW[flv.TAG_TYPE_VIDEO] = frWriter
-		frW[flv.TAG_TYPE_AUDIO] = frWriter
-		frW[flv.TAG_TYPE_META] = frWriter
-
-		writeFrames(frReader, frW, 0)
-	}
-}
-
-func openFrameReader(inF *os.File) (frReader *flv.FlvReader, header *flv.Header, err error) {
-	frReader = flv.NewReader(inF)
-	header, err = frReader.ReadHeader()
-	return
-}
-
-func concatFiles() {
-	log.Printf("Concat files: %#v", inFiles)
-	if outFile == "" {
-		log.Fatal("No output file")
-	}
-	outF, err := os.Create(outFile)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer outF.Close()
-	frW := flv.NewWriter(outF)
-	frWout := make(map[flv.TagType]*flv.FlvWriter)
-	frWout[flv.TAG_TYPE_VIDEO] = frW
-	frWout[flv.TAG_TYPE_AUDIO] = frW
-	frWout[flv.TAG_TYPE_META] = frW
-
-	wh := true // write header to output after read of first file
-	offset := 0
-	for _, fn := range inFiles {
-		inF, err := os.Open(fn)
-		if err != nil {
-			log.Fatal(err)
+		if f.Keyframes && f.SequenceHeaders {
+			return usagef("-keyframes and -sequence-headers exclude each other")
 		}
-		defer inF.Close()
-		frReader, header, err := openFrameReader(inF)
-		if err != nil {
-			log.Fatal(err)
+		if f.Limit < 0 {
+			return usagef("-n must not be negative")
 		}
-		if wh {
-			frW.WriteHeader(header)
-			wh = false
-			commonHeader = header
+		if opts.DumpPayload < 0 {
+			return usagef("-payload must not be negative")
 		}
-
-		offset = writeFrames(frReader, frWout, offset)
-	}
-}
-
-func warnTs(lastTs, stream, currTs uint32) {
-	if verbose {
-		log.Printf("WARN: non monotonically increasing dts in stream %d: %d > %d", stream, lastTs, currTs)
+		return sak.NewJob(*opts).Dump(*inFile, os.Stdout)
 	}
 }
 
-func writeFrames(frReader *flv.FlvReader, frW map[flv.TagType]*flv.FlvWriter, offset int) (outOffset int) {
-	lastTs := make(map[flv.TagType]map[uint32]uint32)
-	lastTsDiff := make(map[flv.TagType]map[uint32]uint32)
-	shiftTs := make(map[flv.TagType]map[uint32]uint32)
-	for _, c := range []flv.TagType{flv.TAG_TYPE_VIDEO, flv.TAG_TYPE_AUDIO, flv.TAG_TYPE_META} {
-		lastTs[c] = make(map[uint32]uint32)
-		lastTsDiff[c] = make(map[uint32]uint32)
-		shiftTs[c] = make(map[uint32]uint32)
-	}
-
-	updateDts := func(cframe flv.Frame) (newDts uint32) {
-		c := cframe.GetType()
-		s := cframe.GetStream()
-		d := cframe.GetDts()
-		if lastTs[c][s] > d {
-			warnTs(lastTs[c][s], s, d)
-			if fixDts {
-				newDts := lastTs[c][s] + lastTsDiff[c][s]
-				shiftTs[c][s] = newDts - d
-				d += shiftTs[c][s]
-			}
+func setupFind(fs *flag.FlagSet, opts *sak.Options) func() error {
+	inFile := fs.String("in", "", "input file")
+	outFile := fs.String("out", "", "write matching tags to FLV file instead of printing them")
+	fs.IntVar(&opts.Dump.Limit, "n", 0, "stop after N matching tags")
+	fs.IntVar(&opts.DumpPayload, "payload", 0, "hex dump N first bytes of tag body with NAL units of AVC and HEVC, AAC frame size and AMF values of script tags")
+	fs.StringVar(&opts.Format, "format", sak.FormatText, "output format: text, jsonl or csv")
+	return func() error {
+		if err := requireFile("in", *inFile); err != nil {
+			return err
 		}
-		d = uint32(int(float64(d)*scaleDts) + offset)
-		lastTsDiff[c][s] = d - lastTs[c][s]
-		lastTs[c][s] = d
-		return d
-	}
-
-	var lastInTs uint32 = 0
-	var compensateTs uint32 = 0
-	for {
-		var rframe flv.Frame
-		var err error
-		var skipBytes int
-
-		rframe, rerr := frReader.ReadFrame()
-		switch {
-		case rerr != nil && !readRecover:
-			log.Fatal(rerr)
-		case rerr != nil && rerr.IsRecoverable():
-			rframe, err, skipBytes = frReader.Recover(rerr, maxScanSize)
-			if err != nil {
-				log.Fatalf("recovery error: %s", err)
-			}
-			log.Printf("recover: got fine frame after %d bytes", skipBytes)
-			continue
-		}
-
-		if rframe != nil {
-
-				// if rframe.GetType() == flv.TAG_TYPE_META {
-				// 	metaBody := rframe.GetBody()
-				// 	buf := bytes.NewReader(*metaBody)
-				// 	dec := amf0.NewDecoder(buf)
-				// 	_, err := dec.Decode()
-				// 	if err != nil {
-				// 		log.Printf("Bad metadata at DTS %d", rframe.GetDts())
-				// 		continue
-				// 	}
-				// }
-
-			isCrop := permitCrop(rframe)
-			isSkip := permitSkip(rframe)
-			isSplitStream := splitStreams && rframe.GetStream() != 0 && rframe.GetType() != flv.TAG_TYPE_META
-			if (streams[rframe.GetType()] != -1 && rframe.GetStream() != uint32(streams[rframe.GetType()])) || isCrop || isSkip || isSplitStream {
-				if compensateDts || isCrop {
-					compensateTs += (rframe.GetDts() - lastInTs)
-				}
-				lastInTs = rframe.GetDts()
-				if splitStreams {
-					err = writeStreamFrame(rframe, outOffset)
-					if err != nil {
-						log.Fatal(err)
-					}
-				}
-				continue
-			}
-			checkSplitWriters(outOffset)
-			lastInTs = rframe.GetDts()
-			newDts := updateDts(rframe) - compensateTs
-			if rframe.GetStream() == 0 {
-				outOffset = int(newDts)
-			}
-			rframe.SetDts(newDts)
-			err = frW[rframe.GetType()].WriteFrame(rframe)
-			if err != nil {
-				log.Fatal(err)
-			}
-		} else {
-			break
+		if fs.NArg() == 0 {
+			return usagef("expression is required, e.g. 'type == video and size > 200k'")
 		}
-	}
-	return
-}
-
-func writeStreamFrame(rframe flv.Frame, baseDts int) (err error) {
-	if streamsWriters == nil {
-		streamsWriters = make(map[uint32]*streamWriter)
-	}
-	stream := rframe.GetStream()
-	var stWr *streamWriter
-	if _, ok := streamsWriters[stream]; !ok {
-		log.Printf("Write new stream %d from dts %d", stream, baseDts)
-		splitFileNumber++
-		stWr = new(streamWriter)
-		stWr.fileName = fmt.Sprintf("n-%05d-ts-%d-s-%d.flv", splitFileNumber, baseDts, stream)
-		stWr.fd, err = os.Create(stWr.fileName)
+		switch opts.Format {
+		case sak.FormatText, sak.FormatJSONL, sak.FormatCSV:
+		default:
+			return usagef("unknown -format %q", opts.Format)
+		}
+		if *outFile != "" && (opts.Format != sak.FormatText || opts.DumpPayload != 0) {
+			return usagef("-format and -payload can not be used with -out")
+		}
+		if opts.DumpPayload < 0 {
+			return usagef("-payload must not be negative")
+		}
+		if opts.Dump.Limit < 0 {
+			return usagef("-n must not be negative")
+		}
+		q, err := sak.ParseQuery(strings.Join(fs.Args(), " "))
 		if err != nil {
-			log.Fatalf("Cannot open file %s: %s", stWr.fileName, err.Error())
-		}
-		stWr.writer = flv.NewWriter(stWr.fd)
-		stWr.writer.WriteHeader(commonHeader)
-		stWr.firstDts = baseDts
-		stWr.offsetDts = rframe.GetDts()
-		streamsWriters[stream] = stWr
-	} else {
-		stWr = streamsWriters[stream]
+			return err
+		}
+		return sak.NewJob(*opts).Find(*inFile, *outFile, q, os.Stdout)
 	}
-	rframe.SetDts(rframe.GetDts() - stWr.offsetDts)
-	stWr.writer.WriteFrame(rframe)
-	stWr.lastDts = baseDts
-	return nil
 }
 
-func checkSplitWriters(baseDts int) {
-	keys := make([]uint32, 0)
-	for k, _ := range streamsWriters {
-		keys = append(keys, k)
-	}
-
-	for _, k := range keys {
-		if (baseDts - streamsWriters[k].lastDts) > splitStreamsStopAfter {
-			streamsWriters[k].fd.Close()
-			log.Printf("Close stream %d", k)
-			if (streamsWriters[k].lastDts - streamsWriters[k].firstDts) < splitStreamsMinimalDuration {
-				// Delete short file
-				log.Printf("Remove short file: %s", streamsWriters[k].fileName)
-				os.Remove(streamsWriters[k].fileName)
+func setupCrop(fs *flag.FlagSet, opts *sak.Options) func() error {
+	inFile := fs.String("in", "", "input file")
+	outFile := fs.String("out", "", "output file")
+	fs.Var((*csRanges)(&opts.Crop), "crop", "crop specified ranges of dts, e.g. 1000..2000,5000")
+	fs.BoolVar(&opts.CropWaitKeyframe, "crop-wait-keyframe", false, "wait video keyframe after cropping")
+	pipelineFlag(fs, opts)
+	return func() error {
+		if err := requireFile("in", *inFile); err != nil {
+			return err
+		}
+		if err := requireFile("out", *outFile); err != nil {
+			return err
+		}
+		if err := noArgs(fs); err != nil {
+			return err
+		}
+		if err := checkPipeline(opts); err != nil {
+			return err
+		}
+		if len(opts.Crop) == 0 {
+			return usagef("-crop is required")
+		}
+		for _, r := range opts.Crop {
+			if r[0] > r[1] {
+				return usagef("bad crop range %d..%d", r[0], r[1])
 			}
-			delete(streamsWriters, k)
 		}
+		return sak.NewJob(*opts).Copy(*inFile, *outFile, false)
 	}
 }
 
-func closeSplitWriters() {
-	if streamsWriters != nil {
-		for _, v := range streamsWriters {
-			v.fd.Close()
+func setupSplit(fs *flag.FlagSet, opts *sak.Options) func() error {
+	inFile := fs.String("in", "", "input file")
+	outFile := fs.String("out", "", "output file for all content")
+	outc := make(csTTS)
+	fs.Var(&outc, "outc", "output frames of declared type to destination, e.g. video:v.flv,audio:a.flv,meta:v.flv")
+	streamsFlags(fs, opts)
+	fs.BoolVar(&opts.SplitStreams, "split-streams", false, "write every non-zero stream to its own file")
+	fs.IntVar(&opts.SplitStreamsMinimalDuration, "split-streams-minimal-duration", 5000, "minimal duration of stream file in milliseconds")
+	fs.IntVar(&opts.SplitStreamsStopAfter, "split-streams-stop-after", 5000, "close stream file after this many milliseconds without frames")
+	fs.BoolVar(&opts.FixDts, "fix-dts", false, "fix non monotonically dts")
+	pipelineFlag(fs, opts)
+	return func() error {
+		if err := requireFile("in", *inFile); err != nil {
+			return err
 		}
-	}
-}
-
-func permitSkip(frame flv.Frame) (isSkip bool) {
-	if frame.GetType() == flv.TAG_TYPE_META {
-		metaBody := frame.GetBody()
-		buf := bytes.NewReader(*metaBody)
-		dec := amf0.NewDecoder(buf)
-		evName, err := dec.Decode()
-		if err == nil {
-			switch evName {
-			case amf0.StringType("onMetaData"):
-				md, err := dec.Decode()
-				if err == nil {
-					var ea map[amf0.StringType]interface{}
-					switch md := md.(type) {
-					case *amf0.EcmaArrayType:
-						ea = *md
-					case *amf0.ObjectType:
-						ea = *md
-					}
-					for skipK, skipV := range skipMeta {
-						if s, ok := ea[amf0.StringType(skipK)]; ok {
-							for _, t := range skipV {
-								if amf0.StringType(t) == s {
-									return true
-								}
-							}
-						}
-					}
-				}
+		if err := noArgs(fs); err != nil {
+			return err
+		}
+		if err := checkPipeline(opts); err != nil {
+			return err
+		}
+		if err := checkStreams(opts); err != nil {
+			return err
+		}
+		switch {
+		case *outFile != "" && len(outc) > 0:
+			return usagef("-out and -outc are mutually exclusive")
+		case *outFile != "":
+			for _, t := range []flv.TagType{flv.TAG_TYPE_VIDEO, flv.TAG_TYPE_AUDIO, flv.TAG_TYPE_META} {
+				outc[t] = *outFile
 			}
+		case len(outc) == 0:
+			return usagef("-outc or -out is required")
 		}
+		return sak.NewJob(*opts).SplitContent(*inFile, outc)
 	}
-	return false
 }
 
-func permitCrop(frame flv.Frame) (isCrop bool) {
-	isCrop = false
-	if len(crop) <= cropIdx {
-		return
-	}
-	start, stop := uint32(crop[cropIdx][0]), uint32(crop[cropIdx][1])
-	if start <= frame.GetDts() && frame.GetDts() <= stop {
-		if cropWaitKeyframe && !cropActive {
-			if isKeyFrame(frame) {
-				cropActive = true
-				isCrop = true
-			}
-		} else {
-			cropActive = true
-			isCrop = true
-		}
-	} else {
-		if cropWaitKeyframe && cropActive {
-			if isKeyFrame(frame) {
-				isCrop = false
-				cropIdx++
-				cropActive = false
-			}
-		} else {
-			if cropActive {
-				cropIdx++
-				cropActive = false
-			}
-			isCrop = false
+func setupConcat(fs *flag.FlagSet, opts *sak.Options) func() error {
+	outFile := fs.String("out", "", "output file")
+	var inFiles csKeys
+	fs.Var(&inFiles, "ins", "input files (comma separated)")
+	fs.BoolVar(&opts.FixDts, "fix-dts", false, "fix non monotonically dts")
+	pipelineFlag(fs, opts)
+	return func() error {
+		if err := requireFile("out", *outFile); err != nil {
+			return err
+		}
+		inFiles = append(inFiles, fs.Args()...)
+		if len(inFiles) == 0 {
+			return usagef("no input files")
 		}
+		if err := checkPipeline(opts); err != nil {
+			return err
+		}
+		return sak.NewJob(*opts).Concat(inFiles, *outFile)
 	}
-	return
 }
 
-func isKeyFrame(frame flv.Frame) (res bool) {
-	res = false
-	switch tfr := frame.(type) {
-	case flv.VideoFrame:
-		if tfr.Flavor == flv.KEYFRAME {
-			res = true
+func setupFix(fs *flag.FlagSet, opts *sak.Options) func() error {
+	inFile := fs.String("in", "", "input file")
+	outFile := fs.String("out", "", "output file")
+	fs.BoolVar(&opts.FixDts, "fix-dts", false, "fix non monotonically dts")
+	fs.Float64Var(&opts.ScaleDts, "scale-dts", 1.0, "scale dts")
+	opts.SkipMeta = make(map[string][]string)
+	fs.Var((*saMeta)(&opts.SkipMeta), "skip-meta", "skip onMetaData tags with specified values of keys, e.g. key=v1|v2")
+	streamsFlags(fs, opts)
+	pipelineFlag(fs, opts)
+	return func() error {
+		if err := requireFile("in", *inFile); err != nil {
+			return err
+		}
+		if err := requireFile("out", *outFile); err != nil {
+			return err
+		}
+		if err := noArgs(fs); err != nil {
+			return err
 		}
+		if err := checkPipeline(opts); err != nil {
+			return err
+		}
+		if err := checkStreams(opts); err != nil {
+			return err
+		}
+		if opts.ScaleDts <= 0 {
+			return usagef("-scale-dts must be positive")
+		}
+		return sak.NewJob(*opts).Copy(*inFile, *outFile, false)
 	}
-	return
 }
 
-func printMetaData(frReader *flv.FlvReader, mk csKeys) {
-	_, metaMapP := createMetaKeyframes(frReader)
-	metaMap := *metaMapP
-	var keys = make(sort.StringSlice, len(metaMap))
-	var i int
-	for k, _ := range metaMap {
-		keys[i] = string(k)
-		i++
-	}
-	sort.Sort(&keys)
-
-	if len(mk) == 0 {
-		for i := range keys {
-			fmt.Printf("%s: %v\n", keys[i], metaMap[amf0.StringType(keys[i])])
-		}
-	} else {
-		for i := range mk {
-			if v, ok := metaMap[amf0.StringType(mk[i])]; ok {
-				switch v := v.(type) {
-				case *amf0.ObjectType:
-					for obk, obv := range *v {
-						fmt.Printf("%s[%s]: %v\n", mk[i], obk, obv)
-					}
-				default:
-					fmt.Printf("%s: %v\n", mk[i], v)
-				}
+func setupMeta(fs *flag.FlagSet, opts *sak.Options) func() error {
+	inFile := fs.String("in", "", "input file")
+	outFile := fs.String("out", "", "output file")
+	cueFile := fs.String("cue-points", "", "insert cue points from JSON (.json) or CSV file")
+	var metaSet kvMeta
+	var metaDelete csKeys
+	fs.Var(&metaSet, "meta-set", "set metadata key[:type]=value, type is string (default), number, boolean, date (RFC 3339), object or array (JSON); may be repeated")
+	fs.Var(&metaDelete, "meta-delete", "delete metadata keys (comma separated); may be repeated")
+	metaJSON := fs.String("meta-from-json", "", "set metadata keys from JSON object of file")
+	fs.BoolVar(&opts.MergeMeta, "merge-meta", false, "keep keys of original metadata which are not computed")
+	fs.Var((*csKeys)(&opts.MergeMetaKeys), "merge-keys", "keep only these original keys with -merge-meta (comma separated)")
+	fs.Var((*csKeys)(&opts.DropMetaKeys), "drop-keys", "drop these original keys with -merge-meta (comma separated)")
+	inPlace := fs.Bool("in-place", false, "rewrite onMetaData of input file instead of writing output, it must fit in the old one")
+	fs.IntVar(&opts.MetaPadding, "reserve-padding", 0, "reserve this many bytes of padding in new onMetaData for later -in-place updates")
+	fs.IntVar(&opts.SeekInterval, "seek-interval", 1000, "interval in milliseconds of seek index built from audio of files without video keyframes")
+	return func() error {
+		if err := requireFile("in", *inFile); err != nil {
+			return err
+		}
+		if *inPlace {
+			if *outFile != "" {
+				return usagef("-out can not be used with -in-place")
+			}
+			if *cueFile != "" {
+				return usagef("-cue-points can not be used with -in-place")
 			}
+		} else if err := requireFile("out", *outFile); err != nil {
+			return err
 		}
-	}
-}
-
-func writeMetaKeyframes(frReader *flv.FlvReader, frWriter *flv.FlvWriter) (inStart int64) {
-	inStart, metaMap := createMetaKeyframes(frReader)
-
-	newBuf := new(bytes.Buffer)
-	newEnc := amf0.NewEncoder(newBuf)
-
-	err := newEnc.Encode(amf0.StringType("onMetaData"))
-	if err != nil {
-		log.Fatalf("%s", err)
-	}
-
-	err = newEnc.Encode(metaMap)
-	if err != nil {
-		log.Fatalf("%s", err)
-	}
-
-	cFrame := &flv.CFrame{
-		Stream: 0,
-		Dts:    0,
-		Type:   flv.TAG_TYPE_META,
-		Flavor: flv.METADATA,
-		Body:   newBuf.Bytes(),
-	}
-	newMdFrame := flv.MetaFrame{
-		CFrame: cFrame,
-	}
-
-	frWriter.WriteFrame(newMdFrame)
-	return inStart
-}
-
-func frameDump(fr flv.Frame) {
-	if flvDump {
-		minValid := (minDts != -1 && fr.GetDts() > uint32(minDts)) || minDts == -1
-		maxValid := (maxDts != -1 && fr.GetDts() < uint32(maxDts)) || maxDts == -1
-		if minValid && maxValid {
-			fmt.Printf("%s\n", fr)
+		if err := noArgs(fs); err != nil {
+			return err
 		}
-	}
-}
-
-func createMetaKeyframes(frReader *flv.FlvReader) (inStart int64, metaMapP *amf0.EcmaArrayType) {
-
-	fi, err := frReader.InFile.Stat()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	filesize := fi.Size()
-
-	frameSize := map[flv.TagType]uint64{flv.TAG_TYPE_VIDEO: 0, flv.TAG_TYPE_AUDIO: 0, flv.TAG_TYPE_META: 0}
-	size := map[flv.TagType]uint64{flv.TAG_TYPE_VIDEO: 0, flv.TAG_TYPE_AUDIO: 0, flv.TAG_TYPE_META: 0}
-	has := map[flv.TagType]bool{flv.TAG_TYPE_VIDEO: false, flv.TAG_TYPE_AUDIO: false, flv.TAG_TYPE_META: false}
-
-	var lastKeyFrameTs, lastVTs, lastTs uint32
-	var width, height uint16
-	var audioRate uint32
-	var dataFrameSize uint64 = 0
-	var videoFrames, audioFrames uint32 = 0, 0
-	var stereo bool = false
-	var videoCodec, audioCodec uint8 = 0, 0
-	var audioSampleSize uint32 = 0
-	var hasKeyframes bool = false
-
-	var oldOnMetaDataSize int64 = 0
-
-	var kfs []kfTimePos
-
-nextFrame:
-	for {
-		frame, rerr := frReader.ReadFrame()
-
-		switch {
-		case rerr != nil && !readRecover:
-			log.Fatal(rerr)
-		case rerr != nil && rerr.IsRecoverable():
-			_, err, skipBytes := frReader.Recover(rerr, maxScanSize)
+		if opts.MetaPadding < 0 {
+			return usagef("-reserve-padding must not be negative")
+		}
+		if opts.SeekInterval <= 0 {
+			return usagef("-seek-interval must be positive")
+		}
+		if !opts.MergeMeta && (len(opts.MergeMetaKeys) > 0 || len(opts.DropMetaKeys) > 0) {
+			return usagef("-merge-keys and -drop-keys need -merge-meta")
+		}
+		if *cueFile != "" {
+			cues, err := sak.LoadCuePoints(*cueFile)
+			if err != nil {
+				return err
+			}
+			opts.CuePoints = cues
+		}
+		opts.MetaSet = make(map[string]interface{})
+		if *metaJSON != "" {
+			values, err := sak.LoadMetaJSON(*metaJSON)
 			if err != nil {
-				log.Fatalf("recovery error: %s", err)
+				return err
 			}
-			log.Printf("recover: got fine frame after %d bytes", skipBytes)
-			continue nextFrame
-		}
-
-		if frame != nil {
-			switch tfr := frame.(type) {
-			// TODO: AvcFrame support
-			case flv.VideoFrame:
-				if (width == 0) || (height == 0) {
-					width, height = tfr.Width, tfr.Height
-					//log.Printf("VideoCodec: %d, Width: %d, Height: %d", tfr.CodecId, tfr.Width, tfr.Height)
-				}
-				switch tfr.Flavor {
-				case flv.KEYFRAME:
-					lastKeyFrameTs = tfr.Dts
-					hasKeyframes = true
-					kfs = append(kfs, kfTimePos{Dts: tfr.Dts, Position: tfr.Position})
-				default:
-					videoFrames++
-				}
-				lastVTs = tfr.Dts
-				videoCodec = uint8(tfr.CodecId)
-			case flv.AudioFrame:
-				audioRate = tfr.Rate
-				if tfr.Channels == flv.AUDIO_TYPE_STEREO {
-					stereo = true
-				}
-				switch tfr.BitSize {
-				case flv.AUDIO_SIZE_8BIT:
-					audioSampleSize = 8
-				case flv.AUDIO_SIZE_16BIT:
-					audioSampleSize = 16
-				}
-				audioCodec = uint8(tfr.CodecId)
-				audioFrames++
-			case flv.MetaFrame:
-				buf := bytes.NewReader(tfr.Body)
-				dec := amf0.NewDecoder(buf)
-
-				evName, err := dec.Decode()
-				if err != nil {
-					log.Printf("Err %v at DTS %d", err, tfr.Dts)
-					break nextFrame
-				}
-				switch evName {
-				case amf0.StringType("onMetaData"):
-					oldOnMetaDataSize = int64(tfr.PrevTagSize)
-					md, err := dec.Decode()
-					if err != nil {
-						break nextFrame
-					}
-
-					var ea map[amf0.StringType]interface{}
-					switch md := md.(type) {
-					case *amf0.EcmaArrayType:
-						ea = *md
-					case *amf0.ObjectType:
-						ea = *md
-					}
-					if verbose {
-						log.Printf("Old onMetaData")
-						for k, v := range ea {
-							log.Printf("%v = %v\n", k, v)
-						}
-					}
-					if width == 0 {
-						if v, ok := ((ea)["width"]); ok {
-							width = uint16(v.(amf0.NumberType))
-						}
-					}
-					if height == 0 {
-						if v, ok := ((ea)["height"]); ok {
-							height = uint16(v.(amf0.NumberType))
-						}
-					}
-				default:
-					log.Printf("Unknown event: %s\n", evName)
-				}
+			for k, v := range values {
+				opts.MetaSet[k] = v
 			}
-			frameSize[frame.GetType()] += uint64(frame.GetPrevTagSize())
-			size[frame.GetType()] += uint64(len(*frame.GetBody()))
-			has[frame.GetType()] = true
-			lastTs = frame.GetDts()
-			frameDump(frame)
-		} else {
-			break
 		}
+		for k, v := range metaSet {
+			opts.MetaSet[k] = v
+		}
+		opts.MetaDelete = metaDelete
+		if *inPlace {
+			return sak.NewJob(*opts).UpdateInPlace(*inFile)
+		}
+		return sak.NewJob(*opts).Copy(*inFile, *outFile, true)
 	}
-	if flvDump && !printInfo {
-		return 0, nil
-	}
-
-	//log.Printf("KFS: %v", kfs)
-	lastKeyFrameTsF := float32(lastKeyFrameTs) / 1000
-	lastVTsF := float32(lastVTs) / 1000
-	duration := float32(lastTs) / 1000
-	dataFrameSize = frameSize[flv.TAG_TYPE_VIDEO] + frameSize[flv.TAG_TYPE_AUDIO] + frameSize[flv.TAG_TYPE_META]
-
-	now := time.Now()
-	metadatadate := float64(now.Unix()*1000) + (float64(now.Nanosecond()) / 1000000)
-
-	videoDataRate := (float32(size[flv.TAG_TYPE_VIDEO]) / float32(duration)) * 8 / 1000
-	audioDataRate := (float32(size[flv.TAG_TYPE_AUDIO]) / float32(duration)) * 8 / 1000
-
-	frameRate := uint8(math.Floor(float64(videoFrames) / float64(duration)))
-
-	//log.Printf("oldOnMetaDataSize: %d, FileSize: %d, LastKeyFrameTS: %f, LastTS: %f, Width: %d, Height: %d, VideoSize: %d, AudioSize: %d, MetaDataSize: %d, DataSize: %d, Duration: %f, MetadataDate: %f, VideoDataRate: %f, AudioDataRate: %f, FrameRate: %d, AudioRate: %d", oldOnMetaDataSize, filesize, lastKeyFrameTsF, lastVTsF, width, height, videoFrameSize, audioFrameSize, metadataFrameSize, dataFrameSize, duration, metadatadate, videoDataRate, audioDataRate, frameRate, audioRate)
-
-	kfTimes := make(amf0.StrictArrayType, 0)
-	kfPositions := make(amf0.StrictArrayType, 0)
-
-	for i := range kfs {
-		kfTimes = append(kfTimes, amf0.NumberType((float64(kfs[i].Dts) / 1000)))
-		kfPositions = append(kfTimes, amf0.NumberType(kfs[i].Position))
-	}
+}
 
-	keyFrames := amf0.ObjectType{
-		"times":         &kfTimes,
-		"filepositions": &kfPositions,
+// runInventory prints one row per file of arguments of info command.
+func runInventory(fs *flag.FlagSet, opts *sak.Options, inFile string, keys csKeys, single bool, columns csKeys) error {
+	if inFile != "" || len(keys) > 0 || single {
+		return usagef("-in, -keys, -report and -verify-index can not be used with several files")
 	}
-
-	has[flv.TAG_TYPE_META] = true
-
-	metaMap := amf0.EcmaArrayType{
-		"metadatacreator": amf0.StringType("FlvSAK https://github.com/metachord/flvsak"),
-		"metadatadate":    amf0.DateType{TimeZone: 0, Date: metadatadate},
-
-		"keyframes": &keyFrames,
-
-		"hasVideo":     amf0.BooleanType(has[flv.TAG_TYPE_VIDEO]),
-		"hasAudio":     amf0.BooleanType(has[flv.TAG_TYPE_AUDIO]),
-		"hasMetadata":  amf0.BooleanType(has[flv.TAG_TYPE_META]),
-		"hasKeyframes": amf0.BooleanType(hasKeyframes),
-		"hasCuePoints": amf0.BooleanType(false),
-
-		"videocodecid":  amf0.NumberType(videoCodec),
-		"width":         amf0.NumberType(width),
-		"height":        amf0.NumberType(height),
-		"videosize":     amf0.NumberType(frameSize[flv.TAG_TYPE_VIDEO]),
-		"framerate":     amf0.NumberType(frameRate),
-		"videodatarate": amf0.NumberType(videoDataRate),
-
-		"audiocodecid":    amf0.NumberType(audioCodec),
-		"stereo":          amf0.BooleanType(stereo),
-		"audiosamplesize": amf0.NumberType(audioSampleSize),
-		"audiodelay":      amf0.NumberType(0),
-		"audiodatarate":   amf0.NumberType(audioDataRate),
-		"audiosize":       amf0.NumberType(frameSize[flv.TAG_TYPE_AUDIO]),
-		"audiosamplerate": amf0.NumberType(audioRate),
-
-		"filesize":              amf0.NumberType(filesize),
-		"datasize":              amf0.NumberType(dataFrameSize),
-		"lasttimestamp":         amf0.NumberType(lastVTsF),
-		"lastkeyframetimestamp": amf0.NumberType(lastKeyFrameTsF),
-		"cuePoints":             &amf0.StrictArrayType{},
-		"duration":              amf0.NumberType(duration),
-		"canSeekToEnd":          amf0.BooleanType(false),
+	switch opts.Format {
+	case sak.FormatText, sak.FormatCSV, sak.FormatJSONL:
+	default:
+		return usagef("unknown -format %q for several files", opts.Format)
 	}
-
-	if verbose {
-		log.Printf("New onMetaData")
-		for k, v := range metaMap {
-			log.Printf("%v = %v\n", k, v)
-		}
+	if opts.Workers < 0 {
+		return usagef("-workers must not be negative")
 	}
-
-	buf := new(bytes.Buffer)
-	enc := amf0.NewEncoder(buf)
-	err = enc.Encode(&metaMap)
+	files, err := sak.ExpandInputs(fs.Args())
 	if err != nil {
-		log.Fatalf("%s", err)
+		return err
 	}
-
-	newOnMetaDataSize := int64(buf.Len()) + int64(flv.TAG_HEADER_LENGTH) + int64(flv.PREV_TAG_SIZE_LENGTH)
-	//log.Printf("newOnMetaDataSize: %v", newOnMetaDataSize)
-	//log.Printf("oldKeyFrames: %v", &keyFrames)
-
-	newKfPositions := make(amf0.StrictArrayType, 0)
-
-	var dataDiff int64 = newOnMetaDataSize - oldOnMetaDataSize
-
-	for i := range kfs {
-		newKfPositions = append(newKfPositions, amf0.NumberType(uint64(kfs[i].Position+dataDiff)))
-	}
-	keyFrames["filepositions"] = &newKfPositions
-	metaMap["filesize"] = amf0.NumberType(int64(metaMap["filesize"].(amf0.NumberType)) + dataDiff)
-	metaMap["datasize"] = amf0.NumberType(int64(metaMap["datasize"].(amf0.NumberType)) + dataDiff)
-
-	//log.Printf("newKeyFrames: %v", &keyFrames)
-
-	inStart = kfs[0].Position
-	return inStart, &metaMap
+	return sak.NewJob(*opts).Inventory(files, columns, os.Stdout)
 }
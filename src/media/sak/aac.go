@@ -0,0 +1,70 @@
+package sak
+
+import (
+	"errors"
+)
+
+// AAC packet types of FLV audio tag.
+const (
+	aacSequenceHeader = 0
+	aacRaw            = 1
+)
+
+var aacSampleRates = []int{
+	96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350,
+}
+
+// AACConfig is AudioSpecificConfig from AAC sequence header.
+type AACConfig struct {
+	// ObjectType is audio object type: 2 AAC LC, 5 SBR (HE-AAC), 29 PS (HE-AACv2)...
+	ObjectType int
+	// SampleRate is output sample rate, for SBR the extension sample rate.
+	SampleRate int
+	// ChannelConfig is channel configuration, 0 means defined in PCE.
+	ChannelConfig int
+	// Channels is number of channels, 0 if unknown.
+	Channels int
+}
+
+// ParseAACConfig parses AudioSpecificConfig.
+func ParseAACConfig(data []byte) (c *AACConfig, err error) {
+	br := newBitReader(data)
+	objectType := func() int {
+		t := int(br.bits(5))
+		if t == 31 {
+			t = 32 + int(br.bits(6))
+		}
+		return t
+	}
+	sampleRate := func() int {
+		idx := int(br.bits(4))
+		if idx == 15 {
+			return int(br.bits(24))
+		}
+		if idx < len(aacSampleRates) {
+			return aacSampleRates[idx]
+		}
+		if br.err == nil {
+			br.err = errors.New("reserved AAC sampling frequency index")
+		}
+		return 0
+	}
+
+	c = new(AACConfig)
+	c.ObjectType = objectType()
+	c.SampleRate = sampleRate()
+	c.ChannelConfig = int(br.bits(4))
+	if c.ObjectType == 5 || c.ObjectType == 29 {
+		c.SampleRate = sampleRate()
+	}
+	if br.err != nil {
+		return nil, br.err
+	}
+	switch {
+	case c.ChannelConfig >= 1 && c.ChannelConfig <= 6:
+		c.Channels = c.ChannelConfig
+	case c.ChannelConfig == 7:
+		c.Channels = 8
+	}
+	return c, nil
+}
@@ -0,0 +1,37 @@
+package sak
+
+import (
+	"testing"
+)
+
+func TestParseAACConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   AACConfig
+	}{
+		{"LC 44.1 kHz stereo", "12 10", AACConfig{ObjectType: 2, SampleRate: 44100, ChannelConfig: 2, Channels: 2}},
+		{"LC 48 kHz stereo", "11 90", AACConfig{ObjectType: 2, SampleRate: 48000, ChannelConfig: 2, Channels: 2}},
+		{"LC 22.05 kHz mono", "13 88", AACConfig{ObjectType: 2, SampleRate: 22050, ChannelConfig: 1, Channels: 1}},
+		{"HE-AAC 44.1 kHz stereo", "2b 92 08 00", AACConfig{ObjectType: 5, SampleRate: 44100, ChannelConfig: 2, Channels: 2}},
+		{"LC 5.1", "11 b0", AACConfig{ObjectType: 2, SampleRate: 48000, ChannelConfig: 6, Channels: 6}},
+		{"LC 7.1", "11 b8", AACConfig{ObjectType: 2, SampleRate: 48000, ChannelConfig: 7, Channels: 8}},
+		{"LC channels in PCE", "11 80", AACConfig{ObjectType: 2, SampleRate: 48000}},
+	}
+	for _, tt := range tests {
+		c, err := ParseAACConfig(hexBytes(tt.config))
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if *c != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *c, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "12", "2b 92", "17 90"} {
+		if _, err := ParseAACConfig(hexBytes(bad)); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
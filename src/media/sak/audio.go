@@ -0,0 +1,351 @@
+package sak
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+)
+
+// SoundFormat of FLV audio tag announcing Enhanced RTMP extended header.
+const audioFormatExHeader = 9
+
+// Enhanced RTMP audio packet types.
+const (
+	AudioPacketSequenceStart      = 0
+	AudioPacketCodedFrames        = 1
+	AudioPacketSequenceEnd        = 2
+	AudioPacketMultichannelConfig = 4
+	AudioPacketMultitrack         = 5
+	AudioPacketModEx              = 7
+)
+
+// Enhanced RTMP audio codecs.
+const (
+	FourCCMP3  = ".mp3"
+	FourCCAC3  = "ac-3"
+	FourCCEAC3 = "ec-3"
+	FourCCOpus = "Opus"
+	FourCCFLAC = "fLaC"
+	FourCCAAC  = "mp4a"
+)
+
+// audioCodecNames maps legacy sound formats and FourCC to readable names.
+var audioCodecNames = map[string]string{
+	"0":        "Linear PCM, platform endian",
+	"1":        "ADPCM",
+	"2":        "MP3",
+	"3":        "Linear PCM, little endian",
+	"4":        "Nellymoser 16 kHz mono",
+	"5":        "Nellymoser 8 kHz mono",
+	"6":        "Nellymoser",
+	"7":        "G.711 A-law",
+	"8":        "G.711 mu-law",
+	"10":       "AAC",
+	"11":       "Speex",
+	"14":       "MP3 8 kHz",
+	"15":       "Device-specific sound",
+	FourCCMP3:  "MP3",
+	FourCCAC3:  "AC-3",
+	FourCCEAC3: "E-AC-3",
+	FourCCOpus: "Opus",
+	FourCCFLAC: "FLAC",
+	FourCCAAC:  "AAC",
+}
+
+// AudioTag is parsed header of FLV audio tag, legacy or Enhanced RTMP.
+type AudioTag struct {
+	// Enhanced is true for tags with Enhanced RTMP extended header.
+	Enhanced bool
+	// SoundFormat is codec of legacy tag.
+	SoundFormat int
+	// FourCC is codec of Enhanced RTMP tag.
+	FourCC string
+	// PacketType is AudioPacketType of Enhanced RTMP tag or AACPacketType
+	// of legacy AAC tag.
+	PacketType int
+	// Data is codec payload following the header.
+	Data []byte
+	// Tracks is number of tracks of multitrack tag described by its first
+	// track, 0 for single-track tag.
+	Tracks int
+}
+
+// AudioFormat describes audio stream, zero fields are unknown.
+type AudioFormat struct {
+	SampleRate int
+	Channels   int
+	SampleSize int
+}
+
+// ParseAudioTag parses header of audio tag body.
+func ParseAudioTag(body []byte) (t *AudioTag, err error) {
+	if len(body) < 1 {
+		return nil, errShortData
+	}
+	t = &AudioTag{SoundFormat: int(body[0] >> 4)}
+	if t.SoundFormat != audioFormatExHeader {
+		t.Data = body[1:]
+		if t.SoundFormat == audioCodecAAC {
+			if len(body) < 2 {
+				return nil, errShortData
+			}
+			t.PacketType = int(body[1])
+			t.Data = body[2:]
+		}
+		return t, nil
+	}
+
+	t.Enhanced = true
+	t.SoundFormat = 0
+	t.PacketType = int(body[0] & 0x0f)
+	pos := 1
+	if t.PacketType == AudioPacketModEx {
+		t.PacketType, pos, err = skipModEx(body, pos)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t.PacketType == AudioPacketMultitrack {
+		tracks, err := SplitTracks(flv.TAG_TYPE_AUDIO, body)
+		if err != nil {
+			return nil, err
+		}
+		// describe the first track
+		t, err = ParseAudioTag(tracks[0].Body)
+		if err != nil {
+			return nil, err
+		}
+		t.Tracks = len(tracks)
+		return t, nil
+	}
+	if len(body) < pos+4 {
+		return nil, errShortData
+	}
+	t.FourCC = string(body[pos : pos+4])
+	t.Data = body[pos+4:]
+	return t, nil
+}
+
+// Codec returns name of codec: FourCC of Enhanced RTMP tag or legacy codec id.
+func (t *AudioTag) Codec() string {
+	if t.Enhanced {
+		return t.FourCC
+	}
+	return fmt.Sprintf("%d", t.SoundFormat)
+}
+
+// CodecName returns sound format or FourCC followed by readable name, e.g.
+// "10 (AAC)".
+func (t *AudioTag) CodecName() string {
+	return codecName(t.Codec(), audioCodecNames)
+}
+
+// IsSequenceHeader reports whether tag carries decoder configuration.
+func (t *AudioTag) IsSequenceHeader() bool {
+	if t.Enhanced {
+		return t.PacketType == AudioPacketSequenceStart
+	}
+	return t.SoundFormat == audioCodecAAC && t.PacketType == aacSequenceHeader
+}
+
+// PacketName returns readable name of packet type.
+func (t *AudioTag) PacketName() string {
+	if !t.Enhanced {
+		if t.SoundFormat != audioCodecAAC {
+			return ""
+		}
+		switch t.PacketType {
+		case aacSequenceHeader:
+			return "SequenceHeader"
+		case aacRaw:
+			return "Raw"
+		}
+		return fmt.Sprintf("%d", t.PacketType)
+	}
+	switch t.PacketType {
+	case AudioPacketSequenceStart:
+		return "SequenceStart"
+	case AudioPacketCodedFrames:
+		return "CodedFrames"
+	case AudioPacketSequenceEnd:
+		return "SequenceEnd"
+	case AudioPacketMultichannelConfig:
+		return "MultichannelConfig"
+	}
+	return fmt.Sprintf("%d", t.PacketType)
+}
+
+var errNoAudioFormat = errors.New("no audio format in tag")
+
+// Format returns audio format from sequence header of AAC, Opus and FLAC,
+// from multichannel config packet or from AC-3 and E-AC-3 frame.
+func (t *AudioTag) Format() (f *AudioFormat, err error) {
+	codec := t.FourCC
+	if !t.Enhanced && t.SoundFormat == audioCodecAAC {
+		codec = FourCCAAC
+	}
+	if t.Enhanced && t.PacketType == AudioPacketMultichannelConfig {
+		return parseMultichannelConfig(t.Data)
+	}
+	switch {
+	case codec == FourCCAAC && t.IsSequenceHeader():
+		c, err := ParseAACConfig(t.Data)
+		if err != nil {
+			return nil, err
+		}
+		return &AudioFormat{SampleRate: c.SampleRate, Channels: c.Channels}, nil
+	case codec == FourCCOpus && t.IsSequenceHeader():
+		return parseOpusHead(t.Data)
+	case codec == FourCCFLAC && t.IsSequenceHeader():
+		return parseFLACStreamInfo(t.Data)
+	case codec == FourCCAC3 && t.PacketType == AudioPacketCodedFrames:
+		return parseAC3Frame(t.Data)
+	case codec == FourCCEAC3 && t.PacketType == AudioPacketCodedFrames:
+		return parseEAC3Frame(t.Data)
+	}
+	return nil, errNoAudioFormat
+}
+
+func parseMultichannelConfig(data []byte) (f *AudioFormat, err error) {
+	if len(data) < 2 {
+		return nil, errShortData
+	}
+	return &AudioFormat{Channels: int(data[1])}, nil
+}
+
+// parseOpusHead parses Opus identification header. Opus is always decoded
+// at 48 kHz, input sample rate of the header is informational only.
+func parseOpusHead(data []byte) (f *AudioFormat, err error) {
+	if len(data) < 19 {
+		return nil, errShortData
+	}
+	if !bytes.HasPrefix(data, []byte("OpusHead")) {
+		return nil, errors.New("bad OpusHead magic")
+	}
+	return &AudioFormat{SampleRate: 48000, Channels: int(data[9])}, nil
+}
+
+// parseFLACStreamInfo parses STREAMINFO metadata block, optionally preceded
+// by fLaC marker.
+func parseFLACStreamInfo(data []byte) (f *AudioFormat, err error) {
+	data = bytes.TrimPrefix(data, []byte(FourCCFLAC))
+	if len(data) < 4+18 {
+		return nil, errShortData
+	}
+	if data[0]&0x7f != 0 {
+		return nil, errors.New("FLAC sequence start does not begin with STREAMINFO")
+	}
+	info := data[4:]
+	v := binary.BigEndian.Uint32(info[10:14])
+	return &AudioFormat{
+		SampleRate: int(v >> 12),
+		Channels:   int(v>>9&0x07) + 1,
+		SampleSize: int(v>>4&0x1f) + 1,
+	}, nil
+}
+
+var (
+	ac3SampleRates  = []int{48000, 44100, 32000}
+	eac3SampleRates = []int{24000, 22050, 16000}
+	// channels of acmod without LFE
+	ac3Channels = []int{2, 1, 2, 3, 3, 4, 4, 5}
+)
+
+const ac3SyncWord = 0x0b77
+
+// parseAC3Frame parses header of AC-3 syncframe.
+func parseAC3Frame(data []byte) (f *AudioFormat, err error) {
+	if len(data) < 7 {
+		return nil, errShortData
+	}
+	br := newBitReader(data)
+	if br.bits(16) != ac3SyncWord {
+		return nil, errors.New("bad AC-3 sync word")
+	}
+	br.bits(16) // crc1
+	fscod := int(br.bits(2))
+	br.bits(6) // frmsizecod
+	br.bits(5) // bsid
+	br.bits(3) // bsmod
+	acmod := int(br.bits(3))
+	if acmod&1 != 0 && acmod != 1 {
+		br.bits(2) // cmixlev
+	}
+	if acmod&4 != 0 {
+		br.bits(2) // surmixlev
+	}
+	if acmod == 2 {
+		br.bits(2) // dsurmod
+	}
+	lfe := int(br.bit())
+	if br.err != nil {
+		return nil, br.err
+	}
+	if fscod >= len(ac3SampleRates) {
+		return nil, errors.New("bad AC-3 sample rate code")
+	}
+	return &AudioFormat{SampleRate: ac3SampleRates[fscod], Channels: ac3Channels[acmod] + lfe}, nil
+}
+
+// parseEAC3Frame parses header of E-AC-3 syncframe.
+func parseEAC3Frame(data []byte) (f *AudioFormat, err error) {
+	if len(data) < 6 {
+		return nil, errShortData
+	}
+	br := newBitReader(data)
+	if br.bits(16) != ac3SyncWord {
+		return nil, errors.New("bad E-AC-3 sync word")
+	}
+	br.bits(2)  // strmtyp
+	br.bits(3)  // substreamid
+	br.bits(11) // frmsiz
+	f = &AudioFormat{}
+	fscod := int(br.bits(2))
+	if fscod == 3 {
+		fscod2 := int(br.bits(2))
+		if fscod2 >= len(eac3SampleRates) {
+			return nil, errors.New("bad E-AC-3 sample rate code")
+		}
+		f.SampleRate = eac3SampleRates[fscod2]
+	} else {
+		br.bits(2) // numblkscod
+		f.SampleRate = ac3SampleRates[fscod]
+	}
+	acmod := int(br.bits(3))
+	f.Channels = ac3Channels[acmod] + int(br.bit())
+	if br.err != nil {
+		return nil, br.err
+	}
+	return f, nil
+}
+
+// mergeAudioFormat updates known fields of f with known fields of nf.
+func mergeAudioFormat(f, nf *AudioFormat) *AudioFormat {
+	if f == nil {
+		return nf
+	}
+	if nf.SampleRate != 0 {
+		f.SampleRate = nf.SampleRate
+	}
+	if nf.Channels != 0 {
+		f.Channels = nf.Channels
+	}
+	if nf.SampleSize != 0 {
+		f.SampleSize = nf.SampleSize
+	}
+	return f
+}
+
+// audioTag parses header of audio frame, nil for other frames or bad data.
+func audioTag(frame flv.Frame) *AudioTag {
+	if frame.GetType() != flv.TAG_TYPE_AUDIO {
+		return nil
+	}
+	t, err := ParseAudioTag(*frame.GetBody())
+	if err != nil {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,102 @@
+package sak
+
+import (
+	"testing"
+)
+
+const (
+	// OpusHead of libopus stereo stream, pre-skip 312
+	opusHead = "4f 70 75 73 48 65 61 64 01 02 38 01 80 bb 00 00 00 00 00"
+	// fLaC marker and STREAMINFO of 44.1 kHz 16-bit stereo stream
+	flacStreamInfo = "66 4c 61 43 80 00 00 22 10 00 10 00 00 00 0e 00 2a 4b 0a c4 42 f0 00 d9 a3 c6" +
+		" 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00"
+	// header of 48 kHz 5.1 AC-3 syncframe, 448 kbps
+	ac3Frame = "0b 77 1c 3a 1c 40 e1"
+	// header of 48 kHz 5.1 E-AC-3 syncframe, 6 blocks
+	eac3Frame = "0b 77 01 7f 3f 86"
+)
+
+func TestAudioTagFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		codec  string
+		packet string
+		want   AudioFormat
+	}{
+		{"AAC sequence header", "af 00 12 10", "10", "SequenceHeader", AudioFormat{SampleRate: 44100, Channels: 2}},
+		{"Opus sequence start", "90 " + "4f 70 75 73 " + opusHead, FourCCOpus, "SequenceStart", AudioFormat{SampleRate: 48000, Channels: 2}},
+		{"FLAC sequence start", "90 " + "66 4c 61 43 " + flacStreamInfo, FourCCFLAC, "SequenceStart", AudioFormat{SampleRate: 44100, Channels: 2, SampleSize: 16}},
+		{"AC-3 coded frames", "91 " + "61 63 2d 33 " + ac3Frame, FourCCAC3, "CodedFrames", AudioFormat{SampleRate: 48000, Channels: 6}},
+		{"E-AC-3 coded frames", "91 " + "65 63 2d 33 " + eac3Frame, FourCCEAC3, "CodedFrames", AudioFormat{SampleRate: 48000, Channels: 6}},
+		{"multichannel config", "94 " + "4f 70 75 73 " + "01 06 00 00 00 3f", FourCCOpus, "MultichannelConfig", AudioFormat{Channels: 6}},
+	}
+	for _, tt := range tests {
+		body := hexBytes(tt.body)
+		at, err := ParseAudioTag(body)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if at.Codec() != tt.codec || at.PacketName() != tt.packet {
+			t.Errorf("%s: codec %s packet %s", tt.name, at.Codec(), at.PacketName())
+		}
+		f, err := at.Format()
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if *f != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *f, tt.want)
+		}
+
+		// payload cut to its first bytes is not enough for any format
+		at.Data = at.Data[:1]
+		if _, err := at.Format(); err == nil {
+			t.Errorf("%s cut: no error", tt.name)
+		}
+	}
+}
+
+func TestParseAudioTagShort(t *testing.T) {
+	for _, body := range []string{"", "af", "90 4f 70 75"} {
+		if _, err := ParseAudioTag(hexBytes(body)); err == nil {
+			t.Errorf("%q: no error", body)
+		}
+	}
+	at, err := ParseAudioTag(hexBytes("2f ff fb 90 64"))
+	if err != nil || at.Codec() != "2" || at.IsSequenceHeader() || len(at.Data) != 4 {
+		t.Errorf("MP3: %+v, %v", at, err)
+	}
+	if _, err := at.Format(); err != errNoAudioFormat {
+		t.Errorf("MP3 format: %v", err)
+	}
+}
+
+func TestParseAudioFramesTruncated(t *testing.T) {
+	parsers := []struct {
+		name  string
+		parse func([]byte) (*AudioFormat, error)
+		data  string
+	}{
+		{"OpusHead", parseOpusHead, opusHead},
+		{"STREAMINFO", parseFLACStreamInfo, flacStreamInfo},
+		{"AC-3", parseAC3Frame, ac3Frame},
+		{"E-AC-3", parseEAC3Frame, eac3Frame},
+	}
+	for _, p := range parsers {
+		data := hexBytes(p.data)
+		if _, err := p.parse(data); err != nil {
+			t.Errorf("%s: %s", p.name, err)
+		}
+		for n := 0; n < len(data); n++ {
+			if p.name == "STREAMINFO" && n >= 4+4+18 {
+				// MD5 signature is not needed
+				break
+			}
+			if _, err := p.parse(data[:n]); err == nil {
+				t.Errorf("%s cut to %d bytes: no error", p.name, n)
+			}
+		}
+	}
+}
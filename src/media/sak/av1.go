@@ -0,0 +1,102 @@
+package sak
+
+import (
+	"errors"
+)
+
+const av1OBUSequenceHeader = 1
+
+// av1Dimensions returns maximum frame size from sequence header OBU of
+// AV1CodecConfigurationRecord.
+func av1Dimensions(data []byte) (width, height int, err error) {
+	if len(data) < 4 {
+		return 0, 0, errShortData
+	}
+	pos := 4 // configOBUs follow fixed fields
+	for pos < len(data) {
+		header := data[pos]
+		pos++
+		obuType := int(header>>3) & 0x0f
+		if header&0x04 != 0 {
+			pos++ // obu_extension_header
+		}
+		size := len(data) - pos
+		if header&0x02 != 0 {
+			var n int
+			size, n = leb128(data[pos:])
+			if n == 0 {
+				return 0, 0, errShortData
+			}
+			pos += n
+		}
+		if pos+size > len(data) || size < 0 {
+			return 0, 0, errShortData
+		}
+		if obuType == av1OBUSequenceHeader {
+			return parseAV1SequenceHeader(data[pos : pos+size])
+		}
+		pos += size
+	}
+	return 0, 0, errors.New("no sequence header in AV1 sequence start")
+}
+
+func parseAV1SequenceHeader(obu []byte) (width, height int, err error) {
+	br := newBitReader(obu)
+	br.bits(3) // seq_profile
+	br.bit()   // still_picture
+	if br.bit() == 1 {
+		br.bits(5) // seq_level_idx[0]
+	} else {
+		decoderModelInfo := false
+		bufferDelayLength := 0
+		if br.bit() == 1 { // timing_info_present_flag
+			br.bits(32) // num_units_in_display_tick
+			br.bits(32) // time_scale
+			if br.bit() == 1 {
+				br.ue() // num_ticks_per_picture_minus_1, uvlc
+			}
+			decoderModelInfo = br.bit() == 1
+			if decoderModelInfo {
+				bufferDelayLength = int(br.bits(5)) + 1
+				br.bits(32) // num_units_in_decoding_tick
+				br.bits(5)  // buffer_removal_time_length_minus_1
+				br.bits(5)  // frame_presentation_time_length_minus_1
+			}
+		}
+		initialDisplayDelay := br.bit() == 1
+		points := int(br.bits(5)) + 1
+		for i := 0; i < points && br.err == nil; i++ {
+			br.bits(12) // operating_point_idc
+			if br.bits(5) > 7 {
+				br.bit() // seq_tier
+			}
+			if decoderModelInfo && br.bit() == 1 {
+				br.bits(bufferDelayLength) // decoder_buffer_delay
+				br.bits(bufferDelayLength) // encoder_buffer_delay
+				br.bit()                   // low_delay_mode_flag
+			}
+			if initialDisplayDelay && br.bit() == 1 {
+				br.bits(4) // initial_display_delay_minus_1
+			}
+		}
+	}
+	widthBits := int(br.bits(4)) + 1
+	heightBits := int(br.bits(4)) + 1
+	width = int(br.bits(widthBits)) + 1
+	height = int(br.bits(heightBits)) + 1
+	if br.err != nil {
+		return 0, 0, br.err
+	}
+	return width, height, nil
+}
+
+// leb128 decodes unsigned LEB128 number, n is 0 for bad data.
+func leb128(data []byte) (v, n int) {
+	for i := 0; i < 8 && i < len(data); i++ {
+		v |= int(data[i]&0x7f) << uint(7*i)
+		if data[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
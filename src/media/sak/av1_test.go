@@ -0,0 +1,43 @@
+package sak
+
+import (
+	"testing"
+)
+
+// AV1CodecConfigurationRecord of libaom 960x540 Main profile, level 3.0.
+const av1Config960 = "81 00 0c 00 0a 0b 00 00 00 24 cf 7f 0d bf ff 30 08"
+
+func TestAV1Dimensions(t *testing.T) {
+	data := hexBytes(av1Config960)
+	w, h, err := av1Dimensions(data)
+	if err != nil || w != 960 || h != 540 {
+		t.Errorf("got %dx%d, %v", w, h, err)
+	}
+	// picture size ends in the 10th byte of sequence header OBU
+	for n := 0; n < 4+2+10; n++ {
+		if _, _, err := av1Dimensions(data[:n]); err == nil {
+			t.Errorf("cut to %d bytes: no error", n)
+		}
+	}
+	if _, _, err := av1Dimensions(data[:4]); err == nil {
+		t.Error("without OBUs: no error")
+	}
+}
+
+func TestLEB128(t *testing.T) {
+	tests := []struct {
+		data []byte
+		v, n int
+	}{
+		{[]byte{0x0b}, 11, 1},
+		{[]byte{0x80, 0x01}, 128, 2},
+		{[]byte{0xe5, 0x8e, 0x26}, 624485, 3},
+		{[]byte{0x80}, 0, 0},
+		{nil, 0, 0},
+	}
+	for _, tt := range tests {
+		if v, n := leb128(tt.data); v != tt.v || n != tt.n {
+			t.Errorf("% x: got %d, %d, want %d, %d", tt.data, v, n, tt.v, tt.n)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package sak
+
+import (
+	"errors"
+)
+
+// Legacy FLV codec ids used by sak.
+const (
+	videoCodecAVC = 7
+	audioCodecAAC = 10
+)
+
+// AVC packet types of FLV video tag.
+const (
+	avcSequenceHeader = 0
+	avcNALU           = 1
+	avcEndOfSequence  = 2
+)
+
+var errShortData = errors.New("data too short")
+
+// AVCConfig is AVCDecoderConfigurationRecord from AVC sequence header.
+type AVCConfig struct {
+	Profile       uint8
+	Compatibility uint8
+	Level         uint8
+	// NALLengthSize is size in bytes of NAL unit length prefix.
+	NALLengthSize int
+	SPS           [][]byte
+	PPS           [][]byte
+}
+
+// ParseAVCConfig parses AVCDecoderConfigurationRecord.
+func ParseAVCConfig(data []byte) (c *AVCConfig, err error) {
+	if len(data) < 7 {
+		return nil, errShortData
+	}
+	c = &AVCConfig{
+		Profile:       data[1],
+		Compatibility: data[2],
+		Level:         data[3],
+		NALLengthSize: int(data[4]&0x03) + 1,
+	}
+	pos := 5
+	readSets := func(count int) (sets [][]byte, err error) {
+		for i := 0; i < count; i++ {
+			if pos+2 > len(data) {
+				return nil, errShortData
+			}
+			size := int(data[pos])<<8 | int(data[pos+1])
+			pos += 2
+			if pos+size > len(data) {
+				return nil, errShortData
+			}
+			sets = append(sets, data[pos:pos+size])
+			pos += size
+		}
+		return sets, nil
+	}
+	count := int(data[pos] & 0x1f)
+	pos++
+	c.SPS, err = readSets(count)
+	if err != nil {
+		return nil, err
+	}
+	if pos >= len(data) {
+		return nil, errShortData
+	}
+	count = int(data[pos])
+	pos++
+	c.PPS, err = readSets(count)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SPSInfo holds fields of H.264 sequence parameter set flvsak cares about.
+type SPSInfo struct {
+	Profile uint8
+	Level   uint8
+	// ChromaFormat is chroma_format_idc: 0 monochrome, 1 4:2:0, 2 4:2:2, 3 4:4:4.
+	ChromaFormat int
+	// Width and Height are dimensions of picture after cropping.
+	Width, Height int
+	// Crop is frame cropping in pixels: left, right, top, bottom.
+	Crop [4]int
+}
+
+// ParseSPS parses H.264 sequence parameter set NAL unit.
+func ParseSPS(nal []byte) (sps *SPSInfo, err error) {
+	if len(nal) < 4 {
+		return nil, errShortData
+	}
+	br := newBitReader(unescapeRBSP(nal[1:]))
+	sps = &SPSInfo{ChromaFormat: 1}
+	sps.Profile = uint8(br.bits(8))
+	br.bits(8) // constraint flags
+	sps.Level = uint8(br.bits(8))
+	br.ue() // seq_parameter_set_id
+
+	separateColourPlane := false
+	switch sps.Profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		sps.ChromaFormat = int(br.ue())
+		if sps.ChromaFormat == 3 {
+			separateColourPlane = br.bit() == 1
+		}
+		br.ue()  // bit_depth_luma_minus8
+		br.ue()  // bit_depth_chroma_minus8
+		br.bit() // qpprime_y_zero_transform_bypass_flag
+		if br.bit() == 1 {
+			lists := 8
+			if sps.ChromaFormat == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if br.bit() == 1 {
+					size := 16
+					if i >= 6 {
+						size = 64
+					}
+					skipScalingList(br, size)
+				}
+			}
+		}
+	}
+
+	br.ue() // log2_max_frame_num_minus4
+	switch br.ue() {
+	case 0:
+		br.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		br.bit() // delta_pic_order_always_zero_flag
+		br.se()  // offset_for_non_ref_pic
+		br.se()  // offset_for_top_to_bottom_field
+		cycle := br.ue()
+		for i := uint32(0); i < cycle && br.err == nil; i++ {
+			br.se()
+		}
+	}
+	br.ue()  // max_num_ref_frames
+	br.bit() // gaps_in_frame_num_value_allowed_flag
+	widthMbs := int(br.ue()) + 1
+	heightMapUnits := int(br.ue()) + 1
+	frameMbsOnly := int(br.bit())
+	if frameMbsOnly == 0 {
+		br.bit() // mb_adaptive_frame_field_flag
+	}
+	br.bit() // direct_8x8_inference_flag
+
+	var crop [4]int
+	if br.bit() == 1 {
+		for i := range crop {
+			crop[i] = int(br.ue())
+		}
+	}
+	if br.err != nil {
+		return nil, br.err
+	}
+
+	cropUnitX, cropUnitY := 1, 2-frameMbsOnly
+	if sps.ChromaFormat != 0 && !separateColourPlane {
+		subWidthC, subHeightC := 2, 2
+		switch sps.ChromaFormat {
+		case 2:
+			subHeightC = 1
+		case 3:
+			subWidthC, subHeightC = 1, 1
+		}
+		cropUnitX, cropUnitY = subWidthC, subHeightC*(2-frameMbsOnly)
+	}
+	sps.Crop = [4]int{crop[0] * cropUnitX, crop[1] * cropUnitX, crop[2] * cropUnitY, crop[3] * cropUnitY}
+	sps.Width = widthMbs*16 - sps.Crop[0] - sps.Crop[1]
+	sps.Height = (2-frameMbsOnly)*heightMapUnits*16 - sps.Crop[2] - sps.Crop[3]
+	return sps, nil
+}
+
+func skipScalingList(br *bitReader, size int) {
+	last, next := int32(8), int32(8)
+	for j := 0; j < size && br.err == nil; j++ {
+		if next != 0 {
+			next = (last + br.se() + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+}
+
+// unescapeRBSP removes emulation prevention bytes from NAL unit payload.
+func unescapeRBSP(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	zeros := 0
+	for _, b := range data {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// bitReader reads bits and Exp-Golomb codes, the first error sticks and
+// further reads return zeros.
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func newBitReader(data []byte) *bitReader {
+	return &bitReader{data: data}
+}
+
+func (br *bitReader) bit() uint32 {
+	if br.err != nil {
+		return 0
+	}
+	if br.pos >= len(br.data)*8 {
+		br.err = errShortData
+		return 0
+	}
+	b := br.data[br.pos/8] >> uint(7-br.pos%8) & 1
+	br.pos++
+	return uint32(b)
+}
+
+func (br *bitReader) bits(n int) (v uint32) {
+	for i := 0; i < n; i++ {
+		v = v<<1 | br.bit()
+	}
+	return v
+}
+
+func (br *bitReader) ue() uint32 {
+	zeros := 0
+	for br.bit() == 0 {
+		if br.err != nil || zeros == 32 {
+			if br.err == nil {
+				br.err = errors.New("bad exp-golomb code")
+			}
+			return 0
+		}
+		zeros++
+	}
+	return (1<<uint(zeros) - 1) + br.bits(zeros)
+}
+
+func (br *bitReader) se() int32 {
+	v := br.ue()
+	if v&1 == 1 {
+		return int32(v+1) / 2
+	}
+	return -int32(v / 2)
+}
+
+// parseAVCSequenceHeader parses the first SPS of AVCDecoderConfigurationRecord.
+func parseAVCSequenceHeader(data []byte) (sps *SPSInfo, err error) {
+	c, err := ParseAVCConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.SPS) == 0 {
+		return nil, errors.New("no SPS in AVC sequence header")
+	}
+	return ParseSPS(c.SPS[0])
+}
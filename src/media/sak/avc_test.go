@@ -0,0 +1,94 @@
+package sak
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// hexBytes decodes hex dump with spaces.
+func hexBytes(s string) []byte {
+	b, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// x264 SPS of 1280x720 High profile, level 3.1 and its PPS.
+const (
+	spsHigh720 = "67 64 00 1f ac d9 40 50 05 bb 01 10 00 00 03 00 10 00 00 03 03 c0 f1 83 19 60"
+	ppsHigh720 = "68 eb e3 cb 22 c0"
+)
+
+func TestParseSPS(t *testing.T) {
+	tests := []struct {
+		name string
+		sps  string
+		want SPSInfo
+	}{
+		{"baseline 640x480", "67 42 c0 1e 95 a0 28 0f 68 40 00 00 03 00 40 00 00 0c a3 c5 8b a8",
+			SPSInfo{Profile: 66, Level: 30, ChromaFormat: 1, Width: 640, Height: 480}},
+		{"baseline 128x96", "67 42 00 0a f8 41 a2",
+			SPSInfo{Profile: 66, Level: 10, ChromaFormat: 1, Width: 128, Height: 96}},
+		{"main 1280x720", "67 4d 40 1f e8 80 28 02 dd 80 b5 01 01 01 40 00 00 03 00 40 00 00 0c 83 c6 0c 44 80",
+			SPSInfo{Profile: 77, Level: 31, ChromaFormat: 1, Width: 1280, Height: 720}},
+		{"high 1280x720", spsHigh720,
+			SPSInfo{Profile: 100, Level: 31, ChromaFormat: 1, Width: 1280, Height: 720}},
+		{"high 1920x1080 cropped", "67 64 00 28 ac d9 40 78 02 27 e5 c0 44 00 00 03 00 04 00 00 03 00 f0 3c 60 c6 58",
+			SPSInfo{Profile: 100, Level: 40, ChromaFormat: 1, Width: 1920, Height: 1080, Crop: [4]int{0, 0, 0, 8}}},
+	}
+	for _, tt := range tests {
+		data := hexBytes(tt.sps)
+		sps, err := ParseSPS(data)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if *sps != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *sps, tt.want)
+		}
+		// truncated SPS fails or, when cut in trailing VUI, gives the same
+		for n := 0; n < len(data); n++ {
+			if sps, err := ParseSPS(data[:n]); err == nil && *sps != tt.want {
+				t.Errorf("%s cut to %d bytes: got %+v", tt.name, n, *sps)
+			}
+		}
+		if _, err := ParseSPS(data[:5]); err == nil {
+			t.Errorf("%s cut before picture size: no error", tt.name)
+		}
+	}
+}
+
+func TestParseAVCConfig(t *testing.T) {
+	// AVCDecoderConfigurationRecord of x264 with 4-byte NAL lengths
+	data := hexBytes("01 64 00 1f ff e1 00 1a " + spsHigh720 + " 01 00 06 " + ppsHigh720)
+	c, err := ParseAVCConfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &AVCConfig{
+		Profile:       100,
+		Compatibility: 0,
+		Level:         31,
+		NALLengthSize: 4,
+		SPS:           [][]byte{hexBytes(spsHigh720)},
+		PPS:           [][]byte{hexBytes(ppsHigh720)},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+	sps, err := parseAVCSequenceHeader(data)
+	if err != nil || sps.Width != 1280 || sps.Height != 720 {
+		t.Errorf("sequence header: %+v, %v", sps, err)
+	}
+	for n := 0; n < len(data); n++ {
+		if _, err := ParseAVCConfig(data[:n]); err == nil {
+			t.Errorf("cut to %d bytes: no error", n)
+		}
+	}
+	if _, err := parseAVCSequenceHeader(hexBytes("01 64 00 1f ff e0 00")); err == nil {
+		t.Error("no SPS: no error")
+	}
+}
@@ -0,0 +1,196 @@
+package sak
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/metachord/amf.go/amf0"
+	"github.com/metachord/flv.go/flv"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Types of cue points.
+const (
+	CuePointEvent      = "event"
+	CuePointNavigation = "navigation"
+)
+
+// CuePoint is cue point of onCuePoint script tag.
+type CuePoint struct {
+	Name string
+	// Time is dts of the cue point in milliseconds.
+	Time uint32
+	// Type is CuePointEvent or CuePointNavigation.
+	Type       string
+	Parameters map[string]string
+}
+
+// object returns cue point as AMF object of onCuePoint tag and cuePoints
+// array of onMetaData.
+func (c *CuePoint) object() *amf0.ObjectType {
+	params := make(amf0.ObjectType)
+	for k, v := range c.Parameters {
+		params[amf0.StringType(k)] = amf0.StringType(v)
+	}
+	return &amf0.ObjectType{
+		"name":       amf0.StringType(c.Name),
+		"time":       amf0.NumberType(float64(c.Time) / 1000),
+		"type":       amf0.StringType(c.Type),
+		"parameters": &params,
+	}
+}
+
+// body returns body of onCuePoint script tag.
+func (c *CuePoint) body() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := amf0.NewEncoder(buf)
+	if err := enc.Encode(amf0.StringType("onCuePoint")); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(c.object()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sortCuePoints returns copy of cue points ordered by time.
+func sortCuePoints(cues []CuePoint) []CuePoint {
+	sorted := make([]CuePoint, len(cues))
+	copy(sorted, cues)
+	sort.SliceStable(sorted, func(a, b int) bool { return sorted[a].Time < sorted[b].Time })
+	return sorted
+}
+
+// cueJSON is cue point of JSON sidecar, time is in seconds.
+type cueJSON struct {
+	Name       string            `json:"name"`
+	Time       float64           `json:"time"`
+	Type       string            `json:"type"`
+	Parameters map[string]string `json:"parameters"`
+}
+
+// LoadCuePoints reads cue points from sidecar file. Files with .json
+// extension hold array of objects with name, time in seconds, type and
+// parameters. Other files are CSV with columns time in seconds, name, type
+// and any number of key=value parameters; the first line is skipped if it
+// starts with "time". Empty type means event.
+func LoadCuePoints(name string) (cues []CuePoint, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, &InputError{fileLocation(name), err}
+	}
+	defer f.Close()
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		cues, err = readCuePointsJSON(f)
+	} else {
+		cues, err = readCuePointsCSV(f)
+	}
+	if err != nil {
+		return nil, &InputError{fileLocation(name), err}
+	}
+	return cues, nil
+}
+
+func readCuePointsJSON(r io.Reader) (cues []CuePoint, err error) {
+	var in []cueJSON
+	if err = json.NewDecoder(r).Decode(&in); err != nil {
+		return nil, err
+	}
+	for i, c := range in {
+		cue, err := newCuePoint(c.Name, c.Time, c.Type, c.Parameters)
+		if err != nil {
+			return nil, fmt.Errorf("cue point %d: %s", i, err)
+		}
+		cues = append(cues, cue)
+	}
+	return cues, nil
+}
+
+func readCuePointsCSV(r io.Reader) (cues []CuePoint, err error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for i, rec := range records {
+		if i == 0 && len(rec) > 0 && strings.EqualFold(rec[0], "time") {
+			continue
+		}
+		if len(rec) < 2 {
+			return nil, fmt.Errorf("line %d: want time and name", i+1)
+		}
+		t, err := strconv.ParseFloat(rec[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad time: %s", i+1, err)
+		}
+		typ := ""
+		if len(rec) > 2 {
+			typ = rec[2]
+		}
+		params := make(map[string]string)
+		for j := 3; j < len(rec); j++ {
+			kv := strings.SplitN(rec[j], "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("line %d: bad parameter %q, want key=value", i+1, rec[j])
+			}
+			params[kv[0]] = kv[1]
+		}
+		cue, err := newCuePoint(rec[1], t, typ, params)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+		cues = append(cues, cue)
+	}
+	return cues, nil
+}
+
+func newCuePoint(name string, seconds float64, typ string, params map[string]string) (c CuePoint, err error) {
+	if name == "" {
+		return c, errors.New("empty name")
+	}
+	if seconds < 0 || seconds*1000 > math.MaxUint32 {
+		return c, fmt.Errorf("time %v out of range", seconds)
+	}
+	switch typ {
+	case "":
+		typ = CuePointEvent
+	case CuePointEvent, CuePointNavigation:
+	default:
+		return c, fmt.Errorf("unknown type %q", typ)
+	}
+	return CuePoint{Name: name, Time: uint32(math.Round(seconds * 1000)), Type: typ, Parameters: params}, nil
+}
+
+// cuePointsFilter inserts onCuePoint script tags before the first frame
+// at or after time of every cue point.
+type cuePointsFilter struct {
+	cues []CuePoint
+	next int
+}
+
+func (f *cuePointsFilter) Filter(frame flv.Frame) (frames []flv.Frame, err error) {
+	for ; f.next < len(f.cues) && f.cues[f.next].Time <= frame.GetDts(); f.next++ {
+		c := &f.cues[f.next]
+		body, err := c.body()
+		if err != nil {
+			return nil, &MetadataError{Location{Offset: -1, Index: -1}, err}
+		}
+		frames = append(frames, flv.MetaFrame{CFrame: &flv.CFrame{
+			Dts:    c.Time,
+			Type:   flv.TAG_TYPE_META,
+			Flavor: flv.METADATA,
+			Body:   body,
+		}})
+	}
+	return append(frames, frame), nil
+}
@@ -0,0 +1,532 @@
+package sak
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/metachord/amf.go/amf0"
+	"github.com/metachord/flv.go/flv"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FormatFrameHash is output format of Dump printing checksum of every tag
+// body, close to framemd5 of ffmpeg.
+const FormatFrameHash = "framehash"
+
+// Hash functions of FormatFrameHash.
+const (
+	HashMD5    = "md5"
+	HashSHA256 = "sha256"
+)
+
+// DumpFilter selects frames of Dump. Empty lists and -1 bounds select all
+// frames, bounds are inclusive.
+type DumpFilter struct {
+	Types   []flv.TagType
+	Streams []uint32
+	// Keyframes selects video keyframes, SequenceHeaders selects audio and
+	// video tags with decoder configuration.
+	Keyframes       bool
+	SequenceHeaders bool
+	// Events selects script tags by event name.
+	Events []string
+	// MinOffset and MaxOffset bound byte offset of tag, MinIndex and MaxIndex
+	// bound its index counting from 0.
+	MinOffset, MaxOffset int64
+	MinIndex, MaxIndex   int
+	// Limit stops dump after that many frames, 0 means no limit.
+	Limit int
+	// StopPastMaxDts stops reading at the first tag with dts more than that
+	// many milliseconds past MaxDts, -1 reads to the end: FLV does not
+	// order tags by dts, tags following ones past MaxDts may be in range.
+	StopPastMaxDts int
+}
+
+// dumpRecord is one tag of structured dump. Pointer fields are nil where
+// they do not apply to the tag.
+type dumpRecord struct {
+	Offset int64  `json:"offset"`
+	Index  int    `json:"index"`
+	Type   string `json:"type"`
+	Stream uint32 `json:"stream"`
+	Dts    uint32 `json:"dts"`
+	// Cts and Pts are composition time offset and presentation time of AVC
+	// and HEVC coded frames.
+	Cts         *int32 `json:"cts,omitempty"`
+	Pts         *int64 `json:"pts,omitempty"`
+	Size        int    `json:"size"`
+	PrevTagSize uint32 `json:"prev_tag_size"`
+	Keyframe    *bool  `json:"keyframe,omitempty"`
+	Codec       string `json:"codec,omitempty"`
+	PacketType  string `json:"packet_type,omitempty"`
+	Tracks      int    `json:"tracks,omitempty"`
+	// Event is name of script tag, Data are its values following the name.
+	Event string        `json:"event,omitempty"`
+	Data  []interface{} `json:"data,omitempty"`
+	// Error is problem of parsing tag header, AMF values or payload.
+	Error string `json:"error,omitempty"`
+	*dumpPayload
+}
+
+// dumpPayload is content of tag body dumped with DumpPayload option.
+type dumpPayload struct {
+	// Payload is hex of the first bytes of body.
+	Payload  string    `json:"payload"`
+	NALUnits []nalUnit `json:"nal_units,omitempty"`
+	// AACFrameSize is size of raw AAC frame.
+	AACFrameSize *int `json:"aac_frame_size,omitempty"`
+}
+
+// dumpColumns are columns of CSV dump, data is JSON of script values.
+var dumpColumns = []string{"offset", "index", "type", "stream", "dts", "cts", "pts", "size", "prev_tag_size",
+	"keyframe", "codec", "packet_type", "tracks", "event", "data", "error"}
+
+// dumpPayloadColumns follow dumpColumns with DumpPayload option, nal_units
+// is JSON.
+var dumpPayloadColumns = []string{"payload", "nal_units", "aac_frame_size"}
+
+// newDumpRecord describes frame read at loc.
+func newDumpRecord(fr flv.Frame, loc Location) *dumpRecord {
+	body := *fr.GetBody()
+	rec := &dumpRecord{
+		Offset:      loc.Offset,
+		Index:       loc.Index,
+		Type:        tagTypeName(fr.GetType()),
+		Stream:      fr.GetStream(),
+		Dts:         fr.GetDts(),
+		Size:        len(body),
+		PrevTagSize: fr.GetPrevTagSize(),
+	}
+	switch fr.GetType() {
+	case flv.TAG_TYPE_VIDEO:
+		t, err := ParseVideoTag(body)
+		if err != nil {
+			rec.Error = err.Error()
+			return rec
+		}
+		key := t.IsKeyFrame()
+		rec.Keyframe = &key
+		rec.Codec, rec.PacketType, rec.Tracks = t.Codec(), t.PacketName(), t.Tracks
+		if t.hasCompositionTime() {
+			cts, pts := t.CompositionTime, int64(fr.GetDts())+int64(t.CompositionTime)
+			rec.Cts, rec.Pts = &cts, &pts
+		}
+	case flv.TAG_TYPE_AUDIO:
+		t, err := ParseAudioTag(body)
+		if err != nil {
+			rec.Error = err.Error()
+			return rec
+		}
+		rec.Codec, rec.PacketType, rec.Tracks = t.Codec(), t.PacketName(), t.Tracks
+	case flv.TAG_TYPE_META:
+		buf := bytes.NewReader(body)
+		dec := amf0.NewDecoder(buf)
+		for buf.Len() > 0 {
+			v, err := dec.Decode()
+			if err != nil {
+				rec.Error = err.Error()
+				break
+			}
+			if name, ok := v.(amf0.StringType); ok && rec.Event == "" && rec.Data == nil {
+				rec.Event = string(name)
+				continue
+			}
+			rec.Data = append(rec.Data, plainValue(v))
+		}
+	}
+	return rec
+}
+
+// hasCompositionTime reports whether tag is AVC or HEVC coded frame with
+// composition time offset.
+func (t *VideoTag) hasCompositionTime() bool {
+	if t.Enhanced {
+		return t.PacketType == VideoPacketCodedFrames && (t.FourCC == FourCCAVC || t.FourCC == FourCCHEVC)
+	}
+	return (t.CodecID == videoCodecAVC || t.CodecID == videoCodecHEVC) && t.PacketType == avcNALU
+}
+
+// csvRow returns record as cells of dumpColumns.
+func (rec *dumpRecord) csvRow() ([]string, error) {
+	row := []string{
+		strconv.FormatInt(rec.Offset, 10),
+		strconv.Itoa(rec.Index),
+		rec.Type,
+		strconv.FormatUint(uint64(rec.Stream), 10),
+		strconv.FormatUint(uint64(rec.Dts), 10),
+		"", "",
+		strconv.Itoa(rec.Size),
+		strconv.FormatUint(uint64(rec.PrevTagSize), 10),
+		"",
+		rec.Codec,
+		rec.PacketType,
+		"",
+		rec.Event,
+		"",
+		rec.Error,
+	}
+	if rec.Cts != nil {
+		row[5] = strconv.Itoa(int(*rec.Cts))
+		row[6] = strconv.FormatInt(*rec.Pts, 10)
+	}
+	if rec.Keyframe != nil {
+		row[9] = strconv.FormatBool(*rec.Keyframe)
+	}
+	if rec.Tracks > 0 {
+		row[12] = strconv.Itoa(rec.Tracks)
+	}
+	if rec.Data != nil {
+		data, err := json.Marshal(rec.Data)
+		if err != nil {
+			return nil, err
+		}
+		row[14] = string(data)
+	}
+	if p := rec.dumpPayload; p != nil {
+		var units, aac string
+		if p.NALUnits != nil {
+			data, err := json.Marshal(p.NALUnits)
+			if err != nil {
+				return nil, err
+			}
+			units = string(data)
+		}
+		if p.AACFrameSize != nil {
+			aac = strconv.Itoa(*p.AACFrameSize)
+		}
+		row = append(row, p.Payload, units, aac)
+	}
+	return row, nil
+}
+
+// dumpOutput writes dumped frames as text lines, JSON Lines or CSV.
+type dumpOutput struct {
+	format string
+	w      io.Writer
+	csv    *csv.Writer
+	enc    *json.Encoder
+	// count is number of written frames
+	count int
+	// payload is number of body bytes dumped in hex, 0 disables payload
+	payload int
+	// nalLengthSizes are NAL length prefix sizes of AVC and HEVC streams
+	// from their sequence headers
+	nalLengthSizes map[streamKey]int
+	// newHash creates hash of FormatFrameHash, noTimestamps drops dts
+	// column
+	newHash      func() hash.Hash
+	noTimestamps bool
+}
+
+// newDumpOutput returns output to w of Format of opts, CSV and
+// FormatFrameHash start with header. With DumpPayload above 0 its first
+// bytes of every body are dumped with details of payload.
+func newDumpOutput(opts Options, w io.Writer) (*dumpOutput, error) {
+	format, payload := opts.Format, opts.DumpPayload
+	out := &dumpOutput{format: format, w: w, payload: payload, nalLengthSizes: make(map[streamKey]int)}
+	switch format {
+	case "", FormatText:
+	case FormatFrameHash:
+		switch opts.FrameHash {
+		case "", HashMD5:
+			out.newHash = md5.New
+		case HashSHA256:
+			out.newHash = sha256.New
+		default:
+			return nil, optionsErrorf("unknown hash %s, known are %s and %s", opts.FrameHash, HashMD5, HashSHA256)
+		}
+		out.noTimestamps = opts.FrameHashNoTimestamps
+		out.writeFrameHashHeader(opts.FrameHash)
+	case FormatJSONL:
+		out.enc = json.NewEncoder(w)
+	case FormatCSV:
+		out.csv = csv.NewWriter(w)
+		if payload > 0 {
+			out.csv.Write(append(append([]string{}, dumpColumns...), dumpPayloadColumns...))
+		} else {
+			out.csv.Write(dumpColumns)
+		}
+	default:
+		return nil, optionsErrorf("format %s is not supported for dump", format)
+	}
+	return out, nil
+}
+
+// observe keeps NAL length prefix size from AVC and HEVC sequence header
+// frame, all read frames are observed whether they are dumped or not.
+func (o *dumpOutput) observe(fr flv.Frame) {
+	if o.payload <= 0 {
+		return
+	}
+	t := videoTag(fr)
+	if t == nil || !t.IsSequenceHeader() {
+		return
+	}
+	if hevc, ok := nalCodec(t); ok {
+		if size, err := nalLengthSize(t.Data, hevc); err == nil {
+			o.nalLengthSizes[streamKey{fr.GetType(), fr.GetStream()}] = size
+		}
+	}
+}
+
+// nalCodec reports whether tag is AVC or HEVC, whose frames are NAL units.
+func nalCodec(t *VideoTag) (hevc, ok bool) {
+	switch {
+	case t.FourCC == FourCCHEVC || (!t.Enhanced && t.CodecID == videoCodecHEVC):
+		return true, true
+	case t.FourCC == FourCCAVC || (!t.Enhanced && t.CodecID == videoCodecAVC):
+		return false, true
+	}
+	return false, false
+}
+
+// record describes frame read at loc with its payload if enabled.
+func (o *dumpOutput) record(fr flv.Frame, loc Location) *dumpRecord {
+	rec := newDumpRecord(fr, loc)
+	if o.payload <= 0 {
+		return rec
+	}
+	var err error
+	rec.dumpPayload, err = o.payloadOf(fr)
+	if err != nil && rec.Error == "" {
+		rec.Error = err.Error()
+	}
+	return rec
+}
+
+// payloadOf returns payload of frame: hex of its first bytes, NAL units of
+// AVC and HEVC coded frames, size of raw AAC frame.
+func (o *dumpOutput) payloadOf(fr flv.Frame) (p *dumpPayload, err error) {
+	body := *fr.GetBody()
+	n := o.payload
+	if n > len(body) {
+		n = len(body)
+	}
+	p = &dumpPayload{Payload: hex.EncodeToString(body[:n])}
+	if t := videoTag(fr); t != nil {
+		if hevc, ok := nalCodec(t); ok && t.IsCodedFrame() {
+			size, ok := o.nalLengthSizes[streamKey{fr.GetType(), fr.GetStream()}]
+			if !ok {
+				size = 4
+			}
+			p.NALUnits, err = splitNALUnits(t.Data, size, hevc)
+			return p, err
+		}
+	} else if t := audioTag(fr); t != nil {
+		if (t.Enhanced && t.FourCC == FourCCAAC && t.PacketType == AudioPacketCodedFrames) ||
+			(!t.Enhanced && t.SoundFormat == audioCodecAAC && t.PacketType == aacRaw) {
+			size := len(t.Data)
+			p.AACFrameSize = &size
+		}
+	}
+	return p, nil
+}
+
+// writeFrameHashHeader writes comment lines of FormatFrameHash output: hash
+// name, time base of dts and columns.
+func (o *dumpOutput) writeFrameHashHeader(name string) {
+	if name == "" {
+		name = HashMD5
+	}
+	fmt.Fprintf(o.w, "#format: frame checksums\n#version: 1\n#hash: %s\n", strings.ToUpper(name))
+	if o.noTimestamps {
+		fmt.Fprintf(o.w, "#stream, size, hash\n")
+		return
+	}
+	fmt.Fprintf(o.w, "#tb: 1/1000\n#stream, dts, size, hash\n")
+}
+
+// write writes frame read at loc.
+func (o *dumpOutput) write(fr flv.Frame, loc Location) error {
+	o.count++
+	switch {
+	case o.newHash != nil:
+		h := o.newHash()
+		h.Write(*fr.GetBody())
+		stream := fmt.Sprintf("%s:%d,", tagTypeName(fr.GetType()), fr.GetStream())
+		var err error
+		if o.noTimestamps {
+			_, err = fmt.Fprintf(o.w, "%-8s %8d, %x\n", stream, len(*fr.GetBody()), h.Sum(nil))
+		} else {
+			_, err = fmt.Fprintf(o.w, "%-8s %10d, %8d, %x\n", stream, fr.GetDts(), len(*fr.GetBody()), h.Sum(nil))
+		}
+		return err
+	case o.enc != nil:
+		return o.enc.Encode(o.record(fr, loc))
+	case o.csv != nil:
+		row, err := o.record(fr, loc).csvRow()
+		if err != nil {
+			return err
+		}
+		return o.csv.Write(row)
+	}
+	// flv.go knows only legacy audio and video headers
+	var tracks int
+	if t := videoTag(fr); t != nil && t.Enhanced {
+		fmt.Fprintf(o.w, "%s %s frametype=%d packet=%s cts=%d", fr, t.FourCC, t.FrameType, t.PacketName(), t.CompositionTime)
+		tracks = t.Tracks
+	} else if t := audioTag(fr); t != nil && t.Enhanced {
+		fmt.Fprintf(o.w, "%s %s packet=%s", fr, t.FourCC, t.PacketName())
+		tracks = t.Tracks
+	} else {
+		fmt.Fprintf(o.w, "%s", fr)
+	}
+	if tracks > 0 {
+		fmt.Fprintf(o.w, " tracks=%d", tracks)
+	}
+	fmt.Fprintln(o.w)
+	if o.payload > 0 {
+		o.writePayloadText(o.record(fr, loc), *fr.GetBody())
+	}
+	return nil
+}
+
+// writePayloadText writes payload of record of frame with body as indented
+// lines following text line of the frame.
+func (o *dumpOutput) writePayloadText(rec *dumpRecord, body []byte) {
+	const indent = "    "
+	p := rec.dumpPayload
+	for _, u := range p.NALUnits {
+		fmt.Fprintf(o.w, "%snal type=%d", indent, u.Type)
+		if u.Name != "" {
+			fmt.Fprintf(o.w, " (%s)", u.Name)
+		}
+		fmt.Fprintf(o.w, " size=%d", u.Size)
+		if u.RefIdc != nil {
+			fmt.Fprintf(o.w, " ref_idc=%d", *u.RefIdc)
+		}
+		fmt.Fprintln(o.w)
+	}
+	if p.AACFrameSize != nil {
+		fmt.Fprintf(o.w, "%saac frame size=%d\n", indent, *p.AACFrameSize)
+	}
+	if rec.Event != "" || rec.Data != nil {
+		fmt.Fprintf(o.w, "%samf:\n", indent)
+		writeYAML(o.w, append([]interface{}{rec.Event}, rec.Data...), indent+"  ")
+	}
+	if rec.Error != "" {
+		fmt.Fprintf(o.w, "%serror: %s\n", indent, rec.Error)
+	}
+	if len(body) > o.payload {
+		body = body[:o.payload]
+	}
+	for _, line := range strings.SplitAfter(hex.Dump(body), "\n") {
+		if line != "" {
+			fmt.Fprint(o.w, indent+line)
+		}
+	}
+}
+
+// flush writes buffered CSV rows.
+func (o *dumpOutput) flush() error {
+	if o.csv == nil {
+		return nil
+	}
+	o.csv.Flush()
+	return o.csv.Error()
+}
+
+// frameDump writes frame read at loc to out if it is selected by MinDts,
+// MaxDts and Dump filter of options. stop is set when no more frames can be
+// selected: Limit is reached, frame is past MaxOffset or MaxIndex, or its
+// dts is past MaxDts more than StopPastMaxDts.
+func (j *Job) frameDump(fr flv.Frame, loc Location, out *dumpOutput) (stop bool, err error) {
+	out.observe(fr)
+	f := j.opts.Dump
+	dts := int64(fr.GetDts())
+	switch {
+	case j.opts.MaxDts != -1 && f.StopPastMaxDts != -1 && dts > int64(j.opts.MaxDts)+int64(f.StopPastMaxDts),
+		f.MaxOffset != -1 && loc.Offset > f.MaxOffset,
+		f.MaxIndex != -1 && loc.Index > f.MaxIndex:
+		return true, nil
+	}
+	if !j.dumpSelects(fr, loc) {
+		return false, nil
+	}
+	if err := out.write(fr, loc); err != nil {
+		return true, &OutputError{loc, "", err}
+	}
+	return f.Limit > 0 && out.count >= f.Limit, nil
+}
+
+// dumpSelects reports whether frame read at loc passes MinDts, MaxDts and
+// Dump filter of options.
+func (j *Job) dumpSelects(fr flv.Frame, loc Location) bool {
+	f := j.opts.Dump
+	switch {
+	case j.opts.MinDts != -1 && int64(fr.GetDts()) < int64(j.opts.MinDts),
+		j.opts.MaxDts != -1 && int64(fr.GetDts()) > int64(j.opts.MaxDts),
+		f.MinOffset != -1 && loc.Offset < f.MinOffset,
+		f.MinIndex != -1 && loc.Index < f.MinIndex:
+		return false
+	}
+	if len(f.Types) > 0 && !containsTagType(f.Types, fr.GetType()) {
+		return false
+	}
+	if len(f.Streams) > 0 && !containsStream(f.Streams, fr.GetStream()) {
+		return false
+	}
+	if f.Keyframes && !isKeyFrame(fr) {
+		return false
+	}
+	if f.SequenceHeaders && !isSequenceHeader(fr) {
+		return false
+	}
+	if len(f.Events) > 0 {
+		name, ok := scriptEvent(fr)
+		if !ok || !containsKey(f.Events, name) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsTagType(types []flv.TagType, t flv.TagType) bool {
+	for _, e := range types {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+func containsStream(streams []uint32, stream uint32) bool {
+	for _, e := range streams {
+		if e == stream {
+			return true
+		}
+	}
+	return false
+}
+
+// isSequenceHeader reports whether frame is audio or video tag with decoder
+// configuration.
+func isSequenceHeader(frame flv.Frame) bool {
+	if t := videoTag(frame); t != nil {
+		return t.IsSequenceHeader()
+	}
+	if t := audioTag(frame); t != nil {
+		return t.IsSequenceHeader()
+	}
+	return false
+}
+
+// scriptEvent returns event name of script tag, the first AMF value.
+func scriptEvent(frame flv.Frame) (name string, ok bool) {
+	if frame.GetType() != flv.TAG_TYPE_META {
+		return "", false
+	}
+	v, err := amf0.NewDecoder(bytes.NewReader(*frame.GetBody())).Decode()
+	if err != nil {
+		return "", false
+	}
+	s, ok := v.(amf0.StringType)
+	return string(s), ok
+}
@@ -0,0 +1,60 @@
+package sak
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/metachord/flv.go/flv"
+	"reflect"
+	"testing"
+)
+
+// dumpDts runs frames through frameDump and returns dts of dumped ones.
+func dumpDts(t *testing.T, opts Options, frames []flv.Frame) (dts []uint32) {
+	opts.Format = FormatJSONL
+	j := NewJob(opts)
+	var buf bytes.Buffer
+	out, err := newDumpOutput(j.opts, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, fr := range frames {
+		stop, err := j.frameDump(fr, Location{Index: i, Offset: int64(i)}, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stop {
+			break
+		}
+	}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var rec dumpRecord
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		dts = append(dts, rec.Dts)
+	}
+	return dts
+}
+
+func TestDumpOutOfOrderDts(t *testing.T) {
+	// tags past max-dts are followed by ones in range
+	frames := []flv.Frame{
+		testVideoFrame(0, 500, true),
+		testVideoFrame(0, 1300, false),
+		testVideoFrame(0, 900, false),
+		testVideoFrame(0, 1301, false),
+		testVideoFrame(0, 800, false),
+	}
+	opts := DefaultOptions()
+	opts.MaxDts = 1000
+	if got, want := dumpDts(t, opts, frames), []uint32{500, 900, 800}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dumped dts %v, want %v", got, want)
+	}
+
+	// reading goes on at the bound and stops just past it
+	opts.Dump.StopPastMaxDts = 300
+	if got, want := dumpDts(t, opts, frames), []uint32{500, 900}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dumped dts with StopPastMaxDts %v, want %v", got, want)
+	}
+}
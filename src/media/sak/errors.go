@@ -0,0 +1,103 @@
+package sak
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Location points to a tag of input file.
+type Location struct {
+	File string
+	// Offset is byte offset of the tag, -1 if unknown.
+	Offset int64
+	// Index is number of the tag counting from 0, -1 if unknown.
+	Index int
+	// Dts is dts of the tag, for read errors dts of the last good tag.
+	Dts uint32
+}
+
+func (l Location) String() string {
+	out := make([]string, 0, 4)
+	if l.File != "" {
+		out = append(out, l.File)
+	}
+	if l.Index >= 0 {
+		out = append(out, fmt.Sprintf("tag %d", l.Index))
+	}
+	if l.Offset >= 0 {
+		out = append(out, fmt.Sprintf("offset %d", l.Offset))
+		out = append(out, fmt.Sprintf("dts %d", l.Dts))
+	}
+	return strings.Join(out, " ")
+}
+
+// prefix returns location followed by colon, or nothing for empty location.
+func (l Location) prefix() string {
+	if s := l.String(); s != "" {
+		return s + ": "
+	}
+	return ""
+}
+
+// fileLocation points to the whole file.
+func fileLocation(file string) Location {
+	return Location{File: file, Offset: -1, Index: -1}
+}
+
+// OptionsError reports bad options of a job.
+type OptionsError struct {
+	Msg string
+}
+
+func (e *OptionsError) Error() string {
+	return e.Msg
+}
+
+func optionsErrorf(format string, v ...interface{}) error {
+	return &OptionsError{Msg: fmt.Sprintf(format, v...)}
+}
+
+// InputError reports failure to open or read input file.
+type InputError struct {
+	Location
+	Err error
+}
+
+func (e *InputError) Error() string {
+	return fmt.Sprintf("%sread: %s", e.Location.prefix(), e.Err)
+}
+
+func (e *InputError) Unwrap() error {
+	return e.Err
+}
+
+// OutputError reports failure to create or write output file. Location
+// points to input tag being written.
+type OutputError struct {
+	Location
+	Output string
+	Err    error
+}
+
+func (e *OutputError) Error() string {
+	return fmt.Sprintf("%swrite %s: %s", e.Location.prefix(), e.Output, e.Err)
+}
+
+func (e *OutputError) Unwrap() error {
+	return e.Err
+}
+
+// MetadataError reports bad AMF data in script tag or failure to encode
+// new metadata.
+type MetadataError struct {
+	Location
+	Err error
+}
+
+func (e *MetadataError) Error() string {
+	return fmt.Sprintf("%smetadata: %s", e.Location.prefix(), e.Err)
+}
+
+func (e *MetadataError) Unwrap() error {
+	return e.Err
+}
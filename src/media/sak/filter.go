@@ -0,0 +1,68 @@
+package sak
+
+import (
+	"github.com/metachord/flv.go/flv"
+	"io"
+)
+
+// FrameFilter is a stage of frames processing pipeline. It takes one frame
+// and returns zero or more frames passed to the next stage.
+type FrameFilter interface {
+	Filter(frame flv.Frame) ([]flv.Frame, error)
+}
+
+// FilterFunc adapts ordinary function to FrameFilter.
+type FilterFunc func(frame flv.Frame) ([]flv.Frame, error)
+
+func (f FilterFunc) Filter(frame flv.Frame) ([]flv.Frame, error) {
+	return f(frame)
+}
+
+// Pipeline chains filters in order they were added. Pipeline is a
+// FrameFilter itself, so pipelines may be nested.
+type Pipeline struct {
+	filters []FrameFilter
+}
+
+// NewPipeline creates pipeline of given filters.
+func NewPipeline(filters ...FrameFilter) *Pipeline {
+	return &Pipeline{filters: filters}
+}
+
+// Add appends filter to the end of pipeline.
+func (p *Pipeline) Add(f FrameFilter) *Pipeline {
+	p.filters = append(p.filters, f)
+	return p
+}
+
+// Filter passes frame through all stages of pipeline.
+func (p *Pipeline) Filter(frame flv.Frame) (out []flv.Frame, err error) {
+	out = []flv.Frame{frame}
+	for _, f := range p.filters {
+		var next []flv.Frame
+		for _, fr := range out {
+			res, err := f.Filter(fr)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, res...)
+		}
+		if len(next) == 0 {
+			return nil, nil
+		}
+		out = next
+	}
+	return out, nil
+}
+
+// Close closes every stage implementing io.Closer and returns the first error.
+func (p *Pipeline) Close() (err error) {
+	for _, f := range p.filters {
+		if c, ok := f.(io.Closer); ok {
+			if cerr := c.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
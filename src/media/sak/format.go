@@ -0,0 +1,278 @@
+package sak
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/metachord/amf.go/amf0"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Output formats of Info, FormatCSV and FormatJSONL are of Inventory and
+// Dump.
+const (
+	FormatText  = "text"
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+	FormatXML   = "xml"
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// plainValue converts AMF0 value to value of Go built-in types: objects and
+// ECMA arrays to map[string]interface{}, strict arrays to []interface{},
+// dates to ISO 8601 strings. Numbers which are not finite become nil.
+func plainValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case amf0.NumberType:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return nil
+		}
+		return float64(v)
+	case amf0.BooleanType:
+		return bool(v)
+	case amf0.StringType:
+		return string(v)
+	case amf0.DateType:
+		return formatDate(v)
+	case *amf0.ObjectType:
+		return plainMap(*v)
+	case *amf0.EcmaArrayType:
+		return plainMap(*v)
+	case amf0.ObjectType:
+		return plainMap(v)
+	case amf0.EcmaArrayType:
+		return plainMap(v)
+	case *amf0.StrictArrayType:
+		return plainValue(*v)
+	case amf0.StrictArrayType:
+		arr := make([]interface{}, len(v))
+		for i, e := range v {
+			arr[i] = plainValue(e)
+		}
+		return arr
+	case nil:
+		return nil
+	}
+	return fmt.Sprint(v)
+}
+
+func plainMap(m map[amf0.StringType]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[string(k)] = plainValue(v)
+	}
+	return out
+}
+
+// formatDate returns AMF0 date as ISO 8601 time in UTC with milliseconds.
+func formatDate(d amf0.DateType) string {
+	t := time.Unix(0, int64(math.Round(d.Date))*int64(time.Millisecond))
+	return t.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+// formatNumber formats number the way encoding/json does.
+func formatNumber(f float64) string {
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		return strconv.FormatFloat(f, 'e', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// textValue formats plain value for text output: numbers as formatNumber
+// does, nested objects and arrays as compact JSON.
+func textValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return formatNumber(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return "null"
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeJSON writes plain value v as indented JSON.
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// plainName matches keys written as they are, as YAML plain scalars and
+// XML element names.
+var plainName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// writeYAML writes plain map or slice v as YAML block indented by indent.
+func writeYAML(w io.Writer, v interface{}, indent string) {
+	writeYAMLBlock(w, v, indent, indent)
+}
+
+// writeYAMLBlock writes YAML block with the first line indented by first,
+// maps in lists start on line of their item mark.
+func writeYAMLBlock(w io.Writer, v interface{}, first, indent string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for i, k := range sortedKeys(v) {
+			key := k
+			if !plainName.MatchString(k) {
+				key = strconv.Quote(k)
+			}
+			if i == 0 {
+				fmt.Fprintf(w, "%s%s:", first, key)
+			} else {
+				fmt.Fprintf(w, "%s%s:", indent, key)
+			}
+			writeYAMLNested(w, v[k], indent)
+		}
+	case []interface{}:
+		for i, e := range v {
+			mark := indent + "-"
+			if i == 0 {
+				mark = first + "-"
+			}
+			if m, ok := e.(map[string]interface{}); ok && len(m) > 0 {
+				writeYAMLBlock(w, m, mark+" ", indent+"  ")
+				continue
+			}
+			fmt.Fprint(w, mark)
+			writeYAMLNested(w, e, indent)
+		}
+	}
+}
+
+// writeYAMLNested writes value following key or list item mark.
+func writeYAMLNested(w io.Writer, v interface{}, indent string) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if len(t) == 0 {
+			fmt.Fprintln(w, " {}")
+			return
+		}
+		fmt.Fprintln(w)
+		writeYAML(w, t, indent+"  ")
+	case []interface{}:
+		if len(t) == 0 {
+			fmt.Fprintln(w, " []")
+			return
+		}
+		fmt.Fprintln(w)
+		writeYAML(w, t, indent+"  ")
+	case string:
+		fmt.Fprintf(w, " %s\n", strconv.Quote(t))
+	case float64:
+		fmt.Fprintf(w, " %s\n", formatNumber(t))
+	case bool:
+		fmt.Fprintf(w, " %t\n", t)
+	default:
+		fmt.Fprintln(w, " null")
+	}
+}
+
+// XML layout of flvtool2 -P: fileset of flv elements named by file, value
+// elements have AMF type in type attribute, array items are value elements
+// with index in id attribute.
+const (
+	xmlHeader = "<?xml version='1.0' encoding='UTF-8'?>\n<fileset>\n"
+	xmlFooter = "</fileset>\n"
+)
+
+// writeXMLFile writes flv element of file name with metadata.
+func writeXMLFile(w io.Writer, name string, meta map[amf0.StringType]interface{}) {
+	fmt.Fprintf(w, "  <flv name='%s'>\n", xmlEscape(name))
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, string(k))
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeXMLValue(w, "    ", k, "", meta[amf0.StringType(k)])
+	}
+	fmt.Fprintf(w, "  </flv>\n")
+}
+
+// writeXMLValue writes element of AMF0 value v. Keys which are not XML names
+// are written as value elements with key in name attribute.
+func writeXMLValue(w io.Writer, indent, key, attrs string, v interface{}) {
+	tag := key
+	if !plainName.MatchString(key) {
+		tag = "value"
+		attrs = fmt.Sprintf(" name='%s'", xmlEscape(key))
+	}
+	var typ, text string
+	var children map[amf0.StringType]interface{}
+	var items []interface{}
+	switch v := v.(type) {
+	case amf0.NumberType:
+		typ, text = "Number", formatNumber(float64(v))
+	case amf0.BooleanType:
+		typ, text = "Boolean", strconv.FormatBool(bool(v))
+	case amf0.StringType:
+		typ, text = "String", xmlEscape(string(v))
+	case amf0.DateType:
+		typ, text = "Date", formatDate(v)
+	case *amf0.ObjectType:
+		typ, children = "Object", *v
+	case *amf0.EcmaArrayType:
+		typ, children = "Object", *v
+	case *amf0.StrictArrayType:
+		typ, items = "Array", *v
+	case nil:
+		typ = "Null"
+	default:
+		typ, text = "Unknown", xmlEscape(fmt.Sprint(v))
+	}
+	fmt.Fprintf(w, "%s<%s%s type='%s'", indent, tag, attrs, typ)
+	switch {
+	case len(children) > 0:
+		fmt.Fprintln(w, ">")
+		keys := make([]string, 0, len(children))
+		for k := range children {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			writeXMLValue(w, indent+"  ", k, "", children[amf0.StringType(k)])
+		}
+		fmt.Fprintf(w, "%s</%s>\n", indent, tag)
+	case len(items) > 0:
+		fmt.Fprintln(w, ">")
+		for i, e := range items {
+			writeXMLValue(w, indent+"  ", "value", fmt.Sprintf(" id='%d'", i), e)
+		}
+		fmt.Fprintf(w, "%s</%s>\n", indent, tag)
+	case text != "":
+		fmt.Fprintf(w, ">%s</%s>\n", text, tag)
+	default:
+		fmt.Fprintln(w, "/>")
+	}
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,32 @@
+package sak
+
+import (
+	"github.com/metachord/amf.go/amf0"
+	"testing"
+)
+
+func TestTextValue(t *testing.T) {
+	kfs := amf0.ObjectType{
+		"times":         &amf0.StrictArrayType{amf0.NumberType(0), amf0.NumberType(10.01)},
+		"filepositions": &amf0.StrictArrayType{amf0.NumberType(1193), amf0.NumberType(1193204)},
+	}
+	cue := amf0.ObjectType{"name": amf0.StringType("chapter2"), "time": amf0.NumberType(2)}
+	for _, c := range []struct {
+		v    interface{}
+		want string
+	}{
+		{amf0.NumberType(456947287), "456947287"},
+		{amf0.NumberType(7092.5), "7092.5"},
+		{amf0.BooleanType(true), "true"},
+		{amf0.StringType("FlvSAK"), "FlvSAK"},
+		{amf0.DateType{Date: 1354265321490}, "2012-11-30T08:48:41.490Z"},
+		{&kfs, `{"filepositions":[1193,1193204],"times":[0,10.01]}`},
+		{&amf0.StrictArrayType{&cue}, `[{"name":"chapter2","time":2}]`},
+		{&amf0.StrictArrayType{}, "[]"},
+		{nil, "null"},
+	} {
+		if got := textValue(plainValue(c.v)); got != c.want {
+			t.Errorf("textValue(%v) = %s, want %s", c.v, got, c.want)
+		}
+	}
+}
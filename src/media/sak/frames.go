@@ -0,0 +1,153 @@
+package sak
+
+import (
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"os"
+)
+
+type streamWriter struct {
+	fileName  string
+	fd        *os.File
+	writer    *flv.FlvWriter
+	firstDts  int
+	lastDts   int
+	offsetDts uint32
+}
+
+func (j *Job) warnTs(lastTs, stream, currTs uint32) {
+	if j.opts.Verbose {
+		j.logf("WARN: non monotonically increasing dts in stream %d: %d > %d", stream, lastTs, currTs)
+	}
+}
+
+// WriteFrames copies frames from frReader to writers selected by tag type,
+// passing them through pipeline of stages from options. Frames of types
+// without writer are dropped. All dts are shifted by offset, the last
+// written dts of stream 0 is returned.
+func (j *Job) WriteFrames(r *Reader, frW map[flv.TagType]*flv.FlvWriter, offset int) (outOffset int, err error) {
+	p, err := j.newPipeline(offset)
+	if err != nil {
+		return offset, err
+	}
+	defer func() {
+		if cerr := p.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	j.splitBaseDts = offset
+
+	for {
+		rframe, err := j.readFrame(r)
+		if err != nil {
+			return outOffset, err
+		}
+		if rframe == nil {
+			break
+		}
+		if r.Location().Offset == j.replacedMeta {
+			continue
+		}
+
+		frames, err := p.Filter(rframe)
+		if err != nil {
+			return outOffset, j.locate(r, err)
+		}
+		for _, frame := range frames {
+			if frame.GetStream() == 0 {
+				outOffset = int(frame.GetDts())
+				j.splitBaseDts = outOffset
+			}
+			w := frW[frame.GetType()]
+			if w == nil {
+				continue
+			}
+			err = j.writeFrame(r, w, untrack(frame))
+			if err != nil {
+				return outOffset, err
+			}
+		}
+	}
+	return outOffset, nil
+}
+
+func (j *Job) writeStreamFrame(rframe flv.Frame, baseDts int) (err error) {
+	if j.streamsWriters == nil {
+		j.streamsWriters = make(map[uint32]*streamWriter)
+	}
+	stream := rframe.GetStream()
+	var stWr *streamWriter
+	if _, ok := j.streamsWriters[stream]; !ok {
+		j.logf("Write new stream %d from dts %d", stream, baseDts)
+		j.splitFileNumber++
+		stWr = new(streamWriter)
+		stWr.fileName = fmt.Sprintf("n-%05d-ts-%d-s-%d.flv", j.splitFileNumber, baseDts, stream)
+		stWr.fd, err = os.Create(stWr.fileName)
+		if err != nil {
+			return &OutputError{fileLocation(""), stWr.fileName, err}
+		}
+		stWr.writer = flv.NewWriter(stWr.fd)
+		j.streamsWriters[stream] = stWr
+		err = stWr.writer.WriteHeader(j.header)
+		if err != nil {
+			return &OutputError{fileLocation(""), stWr.fileName, err}
+		}
+		stWr.firstDts = baseDts
+		stWr.offsetDts = rframe.GetDts()
+	} else {
+		stWr = j.streamsWriters[stream]
+	}
+	rframe.SetDts(rframe.GetDts() - stWr.offsetDts)
+	stWr.lastDts = baseDts
+	err = stWr.writer.WriteFrame(untrack(rframe))
+	if err != nil {
+		return &OutputError{fileLocation(""), stWr.fileName, err}
+	}
+	return nil
+}
+
+func (j *Job) checkSplitWriters(baseDts int) {
+	keys := make([]uint32, 0)
+	for k, _ := range j.streamsWriters {
+		keys = append(keys, k)
+	}
+
+	for _, k := range keys {
+		stWr := j.streamsWriters[k]
+		if (baseDts - stWr.lastDts) > j.opts.SplitStreamsStopAfter {
+			stWr.fd.Close()
+			j.logf("Close stream %d", k)
+			if (stWr.lastDts - stWr.firstDts) < j.opts.SplitStreamsMinimalDuration {
+				// Delete short file
+				j.logf("Remove short file: %s", stWr.fileName)
+				os.Remove(stWr.fileName)
+			}
+			delete(j.streamsWriters, k)
+		}
+	}
+}
+
+// locate sets location of errors returned by pipeline stages to the last
+// tag read from r.
+func (j *Job) locate(r *Reader, err error) error {
+	switch e := err.(type) {
+	case *OutputError:
+		if e.Location.File == "" {
+			e.Location = r.Location()
+		}
+	case *MetadataError:
+		if e.Location.File == "" {
+			e.Location = r.Location()
+		}
+	case *InputError, *OptionsError:
+	default:
+		return &InputError{r.Location(), err}
+	}
+	return err
+}
+
+func (j *Job) closeSplitWriters() {
+	for _, v := range j.streamsWriters {
+		v.fd.Close()
+	}
+}
@@ -0,0 +1,110 @@
+package sak
+
+import (
+	"errors"
+)
+
+const hevcNALSPS = 33
+
+// hevcDimensions returns picture size from the first SPS of
+// HEVCDecoderConfigurationRecord.
+func hevcDimensions(data []byte) (width, height int, err error) {
+	if len(data) < 23 {
+		return 0, 0, errShortData
+	}
+	arrays := int(data[22])
+	pos := 23
+	for i := 0; i < arrays; i++ {
+		if pos+3 > len(data) {
+			return 0, 0, errShortData
+		}
+		nalType := data[pos] & 0x3f
+		count := int(data[pos+1])<<8 | int(data[pos+2])
+		pos += 3
+		for j := 0; j < count; j++ {
+			if pos+2 > len(data) {
+				return 0, 0, errShortData
+			}
+			size := int(data[pos])<<8 | int(data[pos+1])
+			pos += 2
+			if pos+size > len(data) {
+				return 0, 0, errShortData
+			}
+			if nalType == hevcNALSPS {
+				return parseHEVCSPS(data[pos : pos+size])
+			}
+			pos += size
+		}
+	}
+	return 0, 0, errors.New("no SPS in HEVC sequence header")
+}
+
+// parseHEVCSPS returns picture size after conformance window cropping from
+// H.265 sequence parameter set NAL unit.
+func parseHEVCSPS(nal []byte) (width, height int, err error) {
+	if len(nal) < 3 {
+		return 0, 0, errShortData
+	}
+	br := newBitReader(unescapeRBSP(nal[2:]))
+	br.bits(4) // sps_video_parameter_set_id
+	maxSubLayers := int(br.bits(3))
+	br.bit() // sps_temporal_id_nesting_flag
+
+	// profile_tier_level
+	br.bits(8)  // general_profile_space, tier_flag, profile_idc
+	br.bits(32) // general_profile_compatibility_flags
+	br.bits(32) // source flags and reserved bits
+	br.bits(16)
+	br.bits(8) // general_level_idc
+	profilePresent := make([]bool, maxSubLayers)
+	levelPresent := make([]bool, maxSubLayers)
+	for i := 0; i < maxSubLayers; i++ {
+		profilePresent[i] = br.bit() == 1
+		levelPresent[i] = br.bit() == 1
+	}
+	if maxSubLayers > 0 {
+		for i := maxSubLayers; i < 8; i++ {
+			br.bits(2) // reserved_zero_2bits
+		}
+	}
+	for i := 0; i < maxSubLayers; i++ {
+		if profilePresent[i] {
+			br.bits(32)
+			br.bits(32)
+			br.bits(24)
+		}
+		if levelPresent[i] {
+			br.bits(8)
+		}
+	}
+
+	br.ue() // sps_seq_parameter_set_id
+	chromaFormat := int(br.ue())
+	separateColourPlane := false
+	if chromaFormat == 3 {
+		separateColourPlane = br.bit() == 1
+	}
+	width = int(br.ue())
+	height = int(br.ue())
+	if br.bit() == 1 {
+		var win [4]int
+		for i := range win {
+			win[i] = int(br.ue())
+		}
+		subWidthC, subHeightC := 1, 1
+		if !separateColourPlane {
+			switch chromaFormat {
+			case 1:
+				subWidthC, subHeightC = 2, 2
+			case 2:
+				subWidthC = 2
+			}
+		}
+		width -= subWidthC * (win[0] + win[1])
+		height -= subHeightC * (win[2] + win[3])
+	}
+	if br.err != nil {
+		return 0, 0, br.err
+	}
+	return width, height, nil
+}
@@ -0,0 +1,64 @@
+package sak
+
+import (
+	"testing"
+)
+
+// x265 parameter sets of 1280x720 Main profile, level 3.1.
+const (
+	vpsMain720 = "40 01 0c 01 ff ff 01 60 00 00 03 00 90 00 00 03 00 00 03 00 5d 95 98 09"
+	spsMain720 = "42 01 01 01 60 00 00 03 00 90 00 00 03 00 00 03 00 5d a0 02 80 80 2d 16 59 59 a4 93 2b c0 5a 70 80 00 01 f4 80 00 30 d4 20"
+	ppsMain720 = "44 01 c1 72 b4 62 40"
+)
+
+func TestParseHEVCSPS(t *testing.T) {
+	tests := []struct {
+		name          string
+		sps           string
+		width, height int
+	}{
+		{"main 1280x720", spsMain720, 1280, 720},
+		{"main 1920x1080 cropped", "42 01 01 01 60 00 00 03 00 90 00 00 03 00 00 03 00 78 a0 03 c0 80 10 e5 96 56 69 24 ca e0 10 00 00 03 00 10 00 00 03 01 e0 80", 1920, 1080},
+	}
+	for _, tt := range tests {
+		data := hexBytes(tt.sps)
+		w, h, err := parseHEVCSPS(data)
+		if err != nil || w != tt.width || h != tt.height {
+			t.Errorf("%s: got %dx%d, %v", tt.name, w, h, err)
+		}
+		for n := 0; n < len(data); n++ {
+			if w, h, err := parseHEVCSPS(data[:n]); err == nil && (w != tt.width || h != tt.height) {
+				t.Errorf("%s cut to %d bytes: got %dx%d", tt.name, n, w, h)
+			}
+		}
+		if _, _, err := parseHEVCSPS(data[:20]); err == nil {
+			t.Errorf("%s cut before picture size: no error", tt.name)
+		}
+	}
+}
+
+func TestHEVCDimensions(t *testing.T) {
+	// HEVCDecoderConfigurationRecord with VPS, SPS and PPS arrays
+	data := hexBytes("01 01 60 00 00 00 90 00 00 00 00 00 5d f0 00 fc fd f8 f8 00 00 0f 03" +
+		" a0 00 01 00 18 " + vpsMain720 +
+		" a1 00 01 00 29 " + spsMain720 +
+		" a2 00 01 00 07 " + ppsMain720)
+	w, h, err := hevcDimensions(data)
+	if err != nil || w != 1280 || h != 720 {
+		t.Errorf("got %dx%d, %v", w, h, err)
+	}
+	if size, err := nalLengthSize(data, true); err != nil || size != 4 {
+		t.Errorf("NAL length size %d, %v", size, err)
+	}
+	// the record is cut before the end of SPS
+	for n := 0; n < 23+5+24+5+41; n++ {
+		if _, _, err := hevcDimensions(data[:n]); err == nil {
+			t.Errorf("cut to %d bytes: no error", n)
+		}
+	}
+	vpsOnly := hexBytes("01 01 60 00 00 00 90 00 00 00 00 00 5d f0 00 fc fd f8 f8 00 00 0f 01" +
+		" a0 00 01 00 18 " + vpsMain720)
+	if _, _, err := hevcDimensions(vpsOnly); err == nil || err == errShortData {
+		t.Errorf("without SPS: %v", err)
+	}
+}
@@ -0,0 +1,320 @@
+package sak
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/metachord/amf.go/amf0"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Columns of Inventory rows. The first column is always file name.
+const (
+	ColumnDuration     = "duration"
+	ColumnVideoCodec   = "video_codec"
+	ColumnAudioCodec   = "audio_codec"
+	ColumnResolution   = "resolution"
+	ColumnFramerate    = "framerate"
+	ColumnBitrate      = "bitrate"
+	ColumnVideoBitrate = "video_bitrate"
+	ColumnAudioBitrate = "audio_bitrate"
+	ColumnSize         = "size"
+	ColumnKeyframes    = "keyframes"
+	ColumnError        = "error"
+)
+
+// InventoryColumns returns all columns of Inventory rows.
+func InventoryColumns() []string {
+	return []string{ColumnDuration, ColumnVideoCodec, ColumnAudioCodec, ColumnResolution, ColumnFramerate,
+		ColumnBitrate, ColumnVideoBitrate, ColumnAudioBitrate, ColumnSize, ColumnKeyframes, ColumnError}
+}
+
+// DefaultInventoryColumns returns columns used when none are given.
+func DefaultInventoryColumns() []string {
+	return []string{ColumnDuration, ColumnVideoCodec, ColumnAudioCodec, ColumnResolution, ColumnBitrate, ColumnSize, ColumnError}
+}
+
+// ExpandInputs returns FLV files of inputs: directories are walked for
+// files with .flv extension, names with glob metacharacters are expanded,
+// other names and patterns matching nothing are kept as they are.
+func ExpandInputs(inputs []string) (files []string, err error) {
+	for _, in := range inputs {
+		if fi, err := os.Stat(in); err == nil && fi.IsDir() {
+			err = filepath.Walk(in, func(path string, fi os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if !fi.IsDir() && strings.EqualFold(filepath.Ext(path), ".flv") {
+					files = append(files, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, &InputError{fileLocation(in), err}
+			}
+			continue
+		}
+		if strings.ContainsAny(in, "*?[") {
+			matches, err := filepath.Glob(in)
+			if err != nil {
+				return nil, &InputError{fileLocation(in), err}
+			}
+			if len(matches) == 0 {
+				// kept to be reported as failed input
+				files = append(files, in)
+				continue
+			}
+			sort.Strings(matches)
+			files = append(files, matches...)
+			continue
+		}
+		files = append(files, in)
+	}
+	return files, nil
+}
+
+// inventoryRow is summary of one file, err is set for broken file.
+type inventoryRow struct {
+	file   string
+	values map[string]interface{}
+	err    error
+}
+
+// Inventory scans files, Workers of options at once, and prints one row
+// of columns per file in order of files: aligned table for FormatText, CSV
+// with header or JSON Lines. Broken files are reported in error column and
+// do not stop the batch, InputError counting them is returned at the end.
+func (j *Job) Inventory(files []string, columns []string, w io.Writer) error {
+	if len(columns) == 0 {
+		columns = DefaultInventoryColumns()
+	}
+	for _, c := range columns {
+		if !containsKey(InventoryColumns(), c) {
+			return optionsErrorf("unknown column %s, known are %s", c, strings.Join(InventoryColumns(), ","))
+		}
+	}
+	var out inventoryWriter
+	switch j.opts.Format {
+	case "", FormatText:
+		out = &tableWriter{w: tabwriter.NewWriter(w, 0, 8, 2, ' ', 0), columns: columns}
+	case FormatCSV:
+		out = &csvWriter{w: csv.NewWriter(w), columns: columns}
+	case FormatJSONL:
+		out = &jsonlWriter{enc: json.NewEncoder(w), columns: columns}
+	default:
+		return optionsErrorf("format %s is not supported for inventory", j.opts.Format)
+	}
+
+	workers := j.opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if err := out.header(); err != nil {
+		return &OutputError{fileLocation(""), "", err}
+	}
+
+	type indexedRow struct {
+		i   int
+		row inventoryRow
+	}
+	jobs := make(chan int)
+	rows := make(chan indexedRow)
+	// done stops workers and feeder when rows are not read any more
+	done := make(chan struct{})
+	defer close(done)
+	for n := 0; n < workers; n++ {
+		go func() {
+			for i := range jobs {
+				select {
+				case rows <- indexedRow{i, NewJob(j.opts).inventoryRow(files[i])}:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range files {
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// rows are written in order of files as soon as all previous are done
+	pending := make(map[int]inventoryRow)
+	next, failed := 0, 0
+	for range files {
+		ir := <-rows
+		pending[ir.i] = ir.row
+		for row, ok := pending[next]; ok; row, ok = pending[next] {
+			delete(pending, next)
+			next++
+			if row.err != nil {
+				failed++
+				j.logf("%s", row.err)
+			}
+			if err := out.row(row); err != nil {
+				return &OutputError{fileLocation(""), "", err}
+			}
+		}
+	}
+	if err := out.flush(); err != nil {
+		return &OutputError{fileLocation(""), "", err}
+	}
+	if failed > 0 {
+		return &InputError{fileLocation(""), fmt.Errorf("%d of %d files failed", failed, len(files))}
+	}
+	return nil
+}
+
+// inventoryRow scans file and returns values of all columns.
+func (j *Job) inventoryRow(file string) inventoryRow {
+	row := inventoryRow{file: file, values: make(map[string]interface{})}
+	var rep *Report
+	var meta amf0.EcmaArrayType
+	_, err := os.Stat(file)
+	if os.IsNotExist(err) && strings.ContainsAny(file, "*?[") {
+		err = &InputError{fileLocation(file), errors.New("no files match pattern")}
+	} else {
+		rep, meta, err = j.scanReport(file)
+	}
+	if err != nil {
+		row.err = err
+		row.values[ColumnError] = err.Error()
+		return row
+	}
+	number := func(key amf0.StringType) float64 {
+		n, _ := meta[key].(amf0.NumberType)
+		return float64(n)
+	}
+	round := func(f float64, digits int) float64 {
+		p := math.Pow(10, float64(digits))
+		return math.Round(f*p) / p
+	}
+	v := row.values
+	v[ColumnDuration] = round(number("duration"), 3)
+	for _, st := range rep.Streams {
+		switch {
+		case st.Type == "video" && v[ColumnVideoCodec] == nil:
+			v[ColumnVideoCodec] = st.Codec
+		case st.Type == "audio" && v[ColumnAudioCodec] == nil:
+			v[ColumnAudioCodec] = st.Codec
+		}
+	}
+	if _, ok := meta["width"]; ok {
+		v[ColumnResolution] = fmt.Sprintf("%.0fx%.0f", number("width"), number("height"))
+		v[ColumnFramerate] = round(number("framerate"), 3)
+		v[ColumnVideoBitrate] = round(number("videodatarate"), 1)
+	}
+	if meta["hasAudio"] == amf0.BooleanType(true) {
+		v[ColumnAudioBitrate] = round(number("audiodatarate"), 1)
+	}
+	v[ColumnBitrate] = round(number("videodatarate")+number("audiodatarate"), 1)
+	v[ColumnSize] = number("filesize")
+	if kfs, ok := meta["keyframes"]; ok {
+		v[ColumnKeyframes] = indexLength(kfs)
+	}
+	v[ColumnError] = ""
+	return row
+}
+
+// inventoryWriter writes rows of Inventory in one of formats.
+type inventoryWriter interface {
+	header() error
+	row(row inventoryRow) error
+	flush() error
+}
+
+// cell formats value of column for table and CSV.
+func cell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+type tableWriter struct {
+	w       *tabwriter.Writer
+	columns []string
+}
+
+func (t *tableWriter) header() error {
+	_, err := fmt.Fprintf(t.w, "file\t%s\n", strings.Join(t.columns, "\t"))
+	return err
+}
+
+func (t *tableWriter) row(row inventoryRow) error {
+	cells := []string{row.file}
+	for _, c := range t.columns {
+		s := cell(row.values[c])
+		if s == "" {
+			s = "-"
+		}
+		cells = append(cells, s)
+	}
+	_, err := fmt.Fprintln(t.w, strings.Join(cells, "\t"))
+	return err
+}
+
+func (t *tableWriter) flush() error {
+	return t.w.Flush()
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+}
+
+func (c *csvWriter) header() error {
+	return c.w.Write(append([]string{"file"}, c.columns...))
+}
+
+func (c *csvWriter) row(row inventoryRow) error {
+	cells := []string{row.file}
+	for _, col := range c.columns {
+		cells = append(cells, cell(row.values[col]))
+	}
+	return c.w.Write(cells)
+}
+
+func (c *csvWriter) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlWriter struct {
+	enc     *json.Encoder
+	columns []string
+}
+
+func (jw *jsonlWriter) header() error {
+	return nil
+}
+
+func (jw *jsonlWriter) row(row inventoryRow) error {
+	obj := map[string]interface{}{"file": row.file}
+	for _, c := range jw.columns {
+		obj[c] = row.values[c]
+	}
+	return jw.enc.Encode(obj)
+}
+
+func (jw *jsonlWriter) flush() error {
+	return nil
+}
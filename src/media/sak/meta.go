@@ -0,0 +1,672 @@
+package sak
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/metachord/amf.go/amf0"
+	"github.com/metachord/flv.go/flv"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// WriteMetaKeyframes writes new onMetaData tag built from r to frWriter.
+// Keyframes positions are computed for output where the new tag is followed
+// by all tags of input except the replaced onMetaData, which position is
+// returned, -1 if input has none.
+func (j *Job) WriteMetaKeyframes(r *Reader, frWriter *flv.FlvWriter) (oldMeta int64, err error) {
+	oldMeta, metaMap, err := j.CreateMetaKeyframes(r)
+	if err != nil {
+		return 0, err
+	}
+
+	body, err := encodeMeta(metaMap)
+	if err != nil {
+		return 0, &MetadataError{fileLocation(r.Name()), err}
+	}
+
+	cFrame := &flv.CFrame{
+		Stream: 0,
+		Dts:    0,
+		Type:   flv.TAG_TYPE_META,
+		Flavor: flv.METADATA,
+		Body:   body,
+	}
+	newMdFrame := flv.MetaFrame{
+		CFrame: cFrame,
+	}
+
+	err = frWriter.WriteFrame(newMdFrame)
+	if err != nil {
+		return 0, &OutputError{fileLocation(r.Name()), frWriter.OutFile.Name(), err}
+	}
+	return oldMeta, nil
+}
+
+// encodeMeta returns body of onMetaData script tag.
+func encodeMeta(metaMap *amf0.EcmaArrayType) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := amf0.NewEncoder(buf)
+	if err := enc.Encode(amf0.StringType("onMetaData")); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(metaMap); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// CreateMetaKeyframes scans r to the end and builds onMetaData with
+// keyframes index, see WriteMetaKeyframes. Returned oldMeta is position of
+// the first onMetaData tag of input which new one replaces, -1 if there is
+// none. Script tags with bad AMF data are skipped.
+func (j *Job) CreateMetaKeyframes(r *Reader) (oldMeta int64, metaMapP *amf0.EcmaArrayType, err error) {
+	metaMapP, stats, err := j.createMeta(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	return stats.oldMetaPosition, metaMapP, nil
+}
+
+// scanStats holds figures found while building onMetaData which are not
+// written to it.
+type scanStats struct {
+	// bitrates of audio and video data in kbit/s
+	minBitrate, maxBitrate, peakBitrate float64
+	// position and body size of the first onMetaData tag, position is -1
+	// if there is none
+	oldMetaPosition int64
+	oldMetaBodySize int
+	// oldMeta is values of the first onMetaData tag
+	oldMeta map[amf0.StringType]interface{}
+	// number and total body size of onMetaData tags counted in streams
+	metaTags  int
+	metaBytes uint64
+	// tags statistics by stream and counts of script tags by event name
+	streams map[streamKey]*StreamReport
+	events  map[string]int
+}
+
+// dataSizes returns datasize by definitions of known tools: tagSizes of
+// all tags, with and without onMetaData tags.
+func (s *scanStats) dataSizes() []float64 {
+	var bytes uint64
+	var tags int
+	for _, st := range s.streams {
+		bytes += st.Bytes
+		tags += st.Tags
+	}
+	return append(tagSizes(bytes, tags), tagSizes(bytes-s.metaBytes, tags-s.metaTags)...)
+}
+
+// typeSizes returns size of tags of type typ, video or audio, by tagSizes
+// definitions.
+func (s *scanStats) typeSizes(typ string) []float64 {
+	var bytes uint64
+	var tags int
+	for _, st := range s.streams {
+		if st.Type == typ {
+			bytes += st.Bytes
+			tags += st.Tags
+		}
+	}
+	return tagSizes(bytes, tags)
+}
+
+// tagSizes returns total size of tags as yamdi, flvtool2, flvmeta and flvsak
+// count it: sum of bodies, of tags with header and of tags with header and
+// previous tag size.
+func tagSizes(bytes uint64, tags int) (sizes []float64) {
+	for _, header := range []int64{0, int64(flv.TAG_HEADER_LENGTH), int64(flv.TAG_HEADER_LENGTH) + int64(flv.PREV_TAG_SIZE_LENGTH)} {
+		sizes = append(sizes, float64(int64(bytes)+header*int64(tags)))
+	}
+	return sizes
+}
+
+func containsSize(sizes []float64, size float64) bool {
+	for _, s := range sizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *Job) createMeta(r *Reader) (metaMapP *amf0.EcmaArrayType, stats *scanStats, err error) {
+
+	fi, err := r.InFile.Stat()
+	if err != nil {
+		return nil, nil, &InputError{fileLocation(r.Name()), err}
+	}
+
+	filesize := fi.Size()
+	stats = &scanStats{
+		oldMetaPosition: -1,
+		streams:         make(map[streamKey]*StreamReport),
+		events:          make(map[string]int),
+	}
+
+	frameSize := map[flv.TagType]uint64{flv.TAG_TYPE_VIDEO: 0, flv.TAG_TYPE_AUDIO: 0, flv.TAG_TYPE_META: 0}
+	size := map[flv.TagType]uint64{flv.TAG_TYPE_VIDEO: 0, flv.TAG_TYPE_AUDIO: 0, flv.TAG_TYPE_META: 0}
+	has := map[flv.TagType]bool{flv.TAG_TYPE_VIDEO: false, flv.TAG_TYPE_AUDIO: false, flv.TAG_TYPE_META: false}
+
+	var lastKeyFrameTs, lastVTs, lastATs uint32
+	var width, height uint16
+	var audioRate uint32
+	var dataFrameSize uint64 = 0
+	var videoFrames, audioFrames uint32 = 0, 0
+	var stereo bool = false
+	var videoCodec uint32 = 0
+	var audioCodec uint32 = 0
+	var audioSampleSize uint32 = 0
+	var hasKeyframes bool = false
+
+	var kfs []kfTimePos
+	// seek points of audio tags for files without video keyframes
+	var audioPoints []kfTimePos
+	cuePoints := make(amf0.StrictArrayType, 0)
+	// cue points of options are inserted before the first frame at or
+	// after their time, inserted is size of insertedTags tags inserted so
+	// far
+	cues := sortCuePoints(j.opts.CuePoints)
+	nextCue := 0
+	var inserted, insertedTags int64
+	var avcSps *SPSInfo
+	var seqWidth, seqHeight int
+	var aacConfig *AACConfig
+	var audioFormat *AudioFormat
+	lines := make(map[streamKey]*timeline)
+	meter := newBitrateMeter()
+
+nextFrame:
+	for {
+		frame, err := j.readFrame(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		if frame == nil {
+			break
+		}
+
+		for ; nextCue < len(cues) && cues[nextCue].Time <= frame.GetDts(); nextCue++ {
+			body, err := cues[nextCue].body()
+			if err != nil {
+				return nil, nil, &MetadataError{fileLocation(r.Name()), err}
+			}
+			inserted += int64(flv.TAG_HEADER_LENGTH + len(body) + flv.PREV_TAG_SIZE_LENGTH)
+			insertedTags++
+			cuePoints = append(cuePoints, cues[nextCue].object())
+		}
+
+		var codec string
+		switch tfr := frame.(type) {
+		case flv.VideoFrame:
+			vt, err := ParseVideoTag(tfr.Body)
+			if err != nil {
+				j.logf("Skip bad video tag header: %s", &InputError{r.Location(), err})
+				break
+			}
+			codec = vt.CodecName()
+			if vt.Enhanced {
+				videoCodec = FourCCNumber(vt.FourCC)
+			} else {
+				videoCodec = uint32(vt.CodecID)
+				if (width == 0) || (height == 0) {
+					width, height = tfr.Width, tfr.Height
+				}
+			}
+			if vt.IsSequenceHeader() && (vt.CodecID == videoCodecAVC || vt.FourCC == FourCCAVC) {
+				sps, err := parseAVCSequenceHeader(vt.Data)
+				if err != nil {
+					j.logf("Skip bad AVC sequence header: %s", &InputError{r.Location(), err})
+				} else {
+					avcSps = sps
+				}
+			}
+			if vt.IsSequenceHeader() || (seqWidth == 0 && vt.FourCC == FourCCVP9 && vt.IsKeyFrame()) {
+				w, h, err := vt.Dimensions()
+				switch {
+				case err == nil:
+					seqWidth, seqHeight = w, h
+				case err != errNoDimensions:
+					j.logf("Skip bad %s sequence header: %s", vt.Codec(), &InputError{r.Location(), err})
+				}
+			}
+			switch {
+			case vt.IsKeyFrame():
+				lastKeyFrameTs = tfr.Dts
+				hasKeyframes = true
+				kfs = append(kfs, kfTimePos{Dts: tfr.Dts, Position: tfr.Position, Inserted: inserted})
+				videoFrames++
+			case vt.IsCodedFrame():
+				videoFrames++
+			}
+			lastVTs = tfr.Dts
+		case flv.AudioFrame:
+			at, err := ParseAudioTag(tfr.Body)
+			if err != nil {
+				j.logf("Skip bad audio tag header: %s", &InputError{r.Location(), err})
+				break
+			}
+			codec = at.CodecName()
+			if at.Enhanced {
+				audioCodec = FourCCNumber(at.FourCC)
+			} else {
+				audioCodec = uint32(at.SoundFormat)
+				audioRate = tfr.Rate
+				if tfr.Channels == flv.AUDIO_TYPE_STEREO {
+					stereo = true
+				}
+				switch tfr.BitSize {
+				case flv.AUDIO_SIZE_8BIT:
+					audioSampleSize = 8
+				case flv.AUDIO_SIZE_16BIT:
+					audioSampleSize = 16
+				}
+			}
+			if at.IsSequenceHeader() && (at.SoundFormat == audioCodecAAC || at.FourCC == FourCCAAC) {
+				c, err := ParseAACConfig(at.Data)
+				if err != nil {
+					j.logf("Skip bad AAC sequence header: %s", &InputError{r.Location(), err})
+				} else {
+					aacConfig = c
+				}
+			}
+			if audioFormat == nil || at.IsSequenceHeader() || (at.Enhanced && at.PacketType == AudioPacketMultichannelConfig) {
+				f, err := at.Format()
+				switch {
+				case err == nil:
+					audioFormat = mergeAudioFormat(audioFormat, f)
+				case err != errNoAudioFormat:
+					j.logf("Skip bad %s audio configuration: %s", at.Codec(), &InputError{r.Location(), err})
+				}
+			}
+			if n := len(audioPoints); n == 0 || tfr.Dts >= audioPoints[n-1].Dts+uint32(j.opts.SeekInterval) {
+				audioPoints = append(audioPoints, kfTimePos{Dts: tfr.Dts, Position: tfr.Position, Inserted: inserted})
+			}
+			lastATs = tfr.Dts
+			audioFrames++
+		case flv.MetaFrame:
+			buf := bytes.NewReader(tfr.Body)
+			dec := amf0.NewDecoder(buf)
+
+			evName, err := dec.Decode()
+			if err != nil {
+				j.logf("Skip bad script tag: %s", &MetadataError{r.Location(), err})
+				continue nextFrame
+			}
+			if name, ok := evName.(amf0.StringType); ok {
+				stats.events[string(name)]++
+			}
+			switch evName {
+			case amf0.StringType("onMetaData"):
+				if stats.oldMetaPosition < 0 {
+					stats.oldMetaPosition = tfr.Position
+					stats.oldMetaBodySize = len(tfr.Body)
+				}
+				md, err := dec.Decode()
+				if err != nil {
+					j.logf("Skip bad onMetaData: %s", &MetadataError{r.Location(), err})
+					continue nextFrame
+				}
+				stats.metaTags++
+				stats.metaBytes += uint64(len(tfr.Body))
+
+				var ea map[amf0.StringType]interface{}
+				switch md := md.(type) {
+				case *amf0.EcmaArrayType:
+					ea = *md
+				case *amf0.ObjectType:
+					ea = *md
+				}
+				if stats.oldMeta == nil {
+					stats.oldMeta = ea
+				}
+				if j.opts.Verbose {
+					j.logf("Old onMetaData")
+					for k, v := range ea {
+						j.logf("%v = %v\n", k, v)
+					}
+				}
+				if width == 0 {
+					if v, ok := ((ea)["width"]).(amf0.NumberType); ok {
+						width = uint16(v)
+					}
+				}
+				if height == 0 {
+					if v, ok := ((ea)["height"]).(amf0.NumberType); ok {
+						height = uint16(v)
+					}
+				}
+			case amf0.StringType("onCuePoint"):
+				cp, err := dec.Decode()
+				if err != nil {
+					j.logf("Skip bad onCuePoint: %s", &MetadataError{r.Location(), err})
+					continue nextFrame
+				}
+				obj := make(amf0.ObjectType)
+				switch cp := cp.(type) {
+				case *amf0.ObjectType:
+					obj = *cp
+				case *amf0.EcmaArrayType:
+					for k, v := range *cp {
+						obj[k] = v
+					}
+				default:
+					j.logf("Skip onCuePoint without object: %s", r.Location())
+					continue nextFrame
+				}
+				if _, ok := obj["time"]; !ok {
+					obj["time"] = amf0.NumberType(float64(tfr.Dts) / 1000)
+				}
+				cuePoints = append(cuePoints, &obj)
+			default:
+				j.logf("Unknown event: %s\n", evName)
+			}
+		}
+		frameSize[frame.GetType()] += uint64(frame.GetPrevTagSize())
+		size[frame.GetType()] += uint64(len(*frame.GetBody()))
+		has[frame.GetType()] = true
+
+		key := streamKey{frame.GetType(), frame.GetStream()}
+		if lines[key] == nil {
+			lines[key] = &timeline{}
+		}
+		lines[key].add(frame.GetDts())
+		st := stats.streams[key]
+		if st == nil {
+			st = &StreamReport{Type: tagTypeName(key.Type), Stream: key.Stream, FirstDts: frame.GetDts()}
+			stats.streams[key] = st
+		}
+		st.Tags++
+		st.LastDts = frame.GetDts()
+		st.Bytes += uint64(len(*frame.GetBody()))
+		if st.Codec == "" {
+			st.Codec = codec
+		}
+		if frame.GetType() != flv.TAG_TYPE_META {
+			meter.add(frame.GetDts(), len(*frame.GetBody()))
+		}
+	}
+
+	for _, c := range cues[nextCue:] {
+		j.logf("Skip cue point %s at %d after the last frame", c.Name, c.Time)
+	}
+	if len(kfs) == 0 {
+		// audio-only file or video without keyframe flags: seek to audio
+		// tags at fixed interval, as yamdi and flvmeta do
+		if has[flv.TAG_TYPE_VIDEO] {
+			j.logf("No video keyframes, index audio every %d ms", j.opts.SeekInterval)
+		}
+		kfs = audioPoints
+		if len(kfs) > 0 {
+			lastKeyFrameTs = kfs[len(kfs)-1].Dts
+		}
+	}
+	if !has[flv.TAG_TYPE_VIDEO] {
+		lastVTs = lastATs
+	}
+
+	// duration ends with the last frame of the longest stream, video
+	// stream with most frames gives frame rate
+	var durationMs, frameRate float64
+	var rateFrames int
+	for key, tl := range lines {
+		end := float64(tl.last)
+		if key.Type != flv.TAG_TYPE_META {
+			end = tl.end()
+		}
+		durationMs = math.Max(durationMs, end)
+		if key.Type == flv.TAG_TYPE_VIDEO && tl.frames > rateFrames {
+			rateFrames = tl.frames
+			if fd := tl.frameDuration(); fd > 0 {
+				frameRate = 1000 / fd
+			}
+		}
+	}
+	if frameRate == 0 && durationMs > 0 {
+		frameRate = float64(videoFrames) * 1000 / durationMs
+	}
+	stats.minBitrate, stats.maxBitrate, stats.peakBitrate = meter.rates()
+
+	lastKeyFrameTsF := float64(lastKeyFrameTs) / 1000
+	lastVTsF := float64(lastVTs) / 1000
+	duration := durationMs / 1000
+	dataFrameSize = frameSize[flv.TAG_TYPE_VIDEO] + frameSize[flv.TAG_TYPE_AUDIO] + frameSize[flv.TAG_TYPE_META]
+
+	now := time.Now()
+	metadatadate := float64(now.Unix()*1000) + (float64(now.Nanosecond()) / 1000000)
+
+	var videoDataRate, audioDataRate float64
+	if duration > 0 {
+		videoDataRate = float64(size[flv.TAG_TYPE_VIDEO]) / duration * 8 / 1000
+		audioDataRate = float64(size[flv.TAG_TYPE_AUDIO]) / duration * 8 / 1000
+	}
+
+	kfTimes := make(amf0.StrictArrayType, 0)
+	kfPositions := make(amf0.StrictArrayType, 0)
+
+	for i := range kfs {
+		kfTimes = append(kfTimes, amf0.NumberType((float64(kfs[i].Dts) / 1000)))
+		kfPositions = append(kfPositions, amf0.NumberType(kfs[i].Position))
+	}
+
+	keyFrames := amf0.ObjectType{
+		"times":         &kfTimes,
+		"filepositions": &kfPositions,
+	}
+
+	has[flv.TAG_TYPE_META] = true
+
+	if seqWidth != 0 {
+		// sequence header is more reliable than stale onMetaData
+		width, height = uint16(seqWidth), uint16(seqHeight)
+	}
+	if audioFormat != nil {
+		// FLV audio header of AAC is always 44 kHz stereo and means nothing
+		// for Enhanced RTMP audio
+		if audioFormat.SampleRate != 0 {
+			audioRate = uint32(audioFormat.SampleRate)
+		}
+		if audioFormat.Channels != 0 {
+			stereo = audioFormat.Channels >= 2
+		}
+		if audioFormat.SampleSize != 0 {
+			audioSampleSize = uint32(audioFormat.SampleSize)
+		}
+	}
+
+	metaMap := amf0.EcmaArrayType{
+		"metadatacreator": amf0.StringType("FlvSAK https://github.com/metachord/flvsak"),
+		"metadatadate":    amf0.DateType{TimeZone: 0, Date: metadatadate},
+
+		"keyframes": &keyFrames,
+
+		"hasVideo":     amf0.BooleanType(has[flv.TAG_TYPE_VIDEO]),
+		"hasAudio":     amf0.BooleanType(has[flv.TAG_TYPE_AUDIO]),
+		"hasMetadata":  amf0.BooleanType(has[flv.TAG_TYPE_META]),
+		"hasKeyframes": amf0.BooleanType(hasKeyframes),
+		"hasCuePoints": amf0.BooleanType(len(cuePoints) > 0),
+
+		"videocodecid":  amf0.NumberType(videoCodec),
+		"width":         amf0.NumberType(width),
+		"height":        amf0.NumberType(height),
+		"videosize":     amf0.NumberType(frameSize[flv.TAG_TYPE_VIDEO]),
+		"framerate":     amf0.NumberType(frameRate),
+		"videodatarate": amf0.NumberType(videoDataRate),
+
+		"audiocodecid":    amf0.NumberType(audioCodec),
+		"stereo":          amf0.BooleanType(stereo),
+		"audiosamplesize": amf0.NumberType(audioSampleSize),
+		"audiodelay":      amf0.NumberType(0),
+		"audiodatarate":   amf0.NumberType(audioDataRate),
+		"audiosize":       amf0.NumberType(frameSize[flv.TAG_TYPE_AUDIO]),
+		"audiosamplerate": amf0.NumberType(audioRate),
+
+		"filesize":              amf0.NumberType(filesize),
+		"datasize":              amf0.NumberType(dataFrameSize),
+		"lasttimestamp":         amf0.NumberType(lastVTsF),
+		"lastkeyframetimestamp": amf0.NumberType(lastKeyFrameTsF),
+		"cuePoints":             &cuePoints,
+		"duration":              amf0.NumberType(duration),
+		"canSeekToEnd":          amf0.BooleanType(false),
+	}
+
+	if avcSps != nil {
+		metaMap["avcprofile"] = amf0.NumberType(avcSps.Profile)
+		metaMap["avclevel"] = amf0.NumberType(avcSps.Level)
+	}
+
+	if aacConfig != nil {
+		metaMap["aacaot"] = amf0.NumberType(aacConfig.ObjectType)
+	}
+	if audioFormat != nil && audioFormat.Channels != 0 {
+		metaMap["audiochannels"] = amf0.NumberType(audioFormat.Channels)
+	}
+
+	if j.opts.MergeMeta {
+		j.mergeMeta(metaMap, stats.oldMeta)
+	}
+	if !has[flv.TAG_TYPE_VIDEO] {
+		// width and height of stale onMetaData mean nothing without video,
+		// they are deleted after merge but may still be set by user
+		for _, k := range []amf0.StringType{"videocodecid", "width", "height", "videosize", "framerate", "videodatarate"} {
+			delete(metaMap, k)
+		}
+	}
+	j.editMeta(metaMap)
+	if j.opts.MetaPadding > 0 && !j.inPlace {
+		if err := addMetaPadding(metaMap, j.opts.MetaPadding); err != nil {
+			return nil, nil, &MetadataError{fileLocation(r.Name()), err}
+		}
+	}
+
+	if j.opts.Verbose {
+		j.logf("New onMetaData")
+		for k, v := range metaMap {
+			j.logf("%v = %v\n", k, v)
+		}
+	}
+
+	// numbers of AMF0 have fixed size, so filling positions and sizes in
+	// does not change size of the tag
+	body, err := encodeMeta(&metaMap)
+	if err != nil {
+		return nil, nil, &MetadataError{fileLocation(r.Name()), err}
+	}
+	newMetaSize := int64(flv.TAG_HEADER_LENGTH + len(body) + flv.PREV_TAG_SIZE_LENGTH)
+	var oldMetaSize int64
+	if stats.oldMetaPosition >= 0 {
+		oldMetaSize = int64(flv.TAG_HEADER_LENGTH + stats.oldMetaBodySize + flv.PREV_TAG_SIZE_LENGTH)
+	}
+
+	// new tag goes first: tags before the old one move forward by its
+	// size, tags after it by difference of sizes
+	newKfPositions := make(amf0.StrictArrayType, 0)
+	for i := range kfs {
+		shift := newMetaSize
+		if stats.oldMetaPosition >= 0 && kfs[i].Position > stats.oldMetaPosition {
+			shift -= oldMetaSize
+		}
+		if j.inPlace {
+			// new tag takes place of the old one, padding fills the rest
+			shift = 0
+		}
+		newKfPositions = append(newKfPositions, amf0.NumberType(uint64(kfs[i].Position+kfs[i].Inserted+shift)))
+	}
+	// datasize counts tags without previous tag size fields
+	fileDiff := newMetaSize - oldMetaSize
+	dataDiff := fileDiff - insertedTags*int64(flv.PREV_TAG_SIZE_LENGTH)
+	if stats.oldMetaPosition < 0 {
+		dataDiff -= int64(flv.PREV_TAG_SIZE_LENGTH)
+	}
+	if j.inPlace {
+		fileDiff, dataDiff = 0, 0
+	}
+	keyFrames["filepositions"] = &newKfPositions
+	if !j.metaEdited("filesize") {
+		metaMap["filesize"] = amf0.NumberType(filesize + fileDiff + inserted)
+	}
+	if !j.metaEdited("datasize") {
+		metaMap["datasize"] = amf0.NumberType(int64(dataFrameSize) + dataDiff + inserted)
+	}
+	return &metaMap, stats, nil
+}
+
+// PrintMetaData writes regenerated metadata of r to w, all keys in
+// alphabetical order or only listed keys.
+func (j *Job) PrintMetaData(r *Reader, mk []string, w io.Writer) (err error) {
+	metaMapP, stats, err := j.createMeta(r)
+	if err != nil {
+		return err
+	}
+	metaMap := *metaMapP
+	metaMap["minbitrate"] = amf0.NumberType(stats.minBitrate)
+	metaMap["maxbitrate"] = amf0.NumberType(stats.maxBitrate)
+	metaMap["peakbitrate"] = amf0.NumberType(stats.peakBitrate)
+
+	switch j.opts.Format {
+	case "", FormatText:
+	case FormatJSON, FormatYAML, FormatXML:
+		return j.printMetaFormatted(r.Name(), metaMap, mk, w)
+	default:
+		return optionsErrorf("unknown format: %s", j.opts.Format)
+	}
+
+	var keys = make(sort.StringSlice, len(metaMap))
+	var i int
+	for k, _ := range metaMap {
+		keys[i] = string(k)
+		i++
+	}
+	sort.Sort(&keys)
+
+	if len(mk) == 0 {
+		for i := range keys {
+			fmt.Fprintf(w, "%s: %s\n", keys[i], textValue(plainValue(metaMap[amf0.StringType(keys[i])])))
+		}
+	} else {
+		for i := range mk {
+			if v, ok := metaMap[amf0.StringType(mk[i])]; ok {
+				switch v := plainValue(v).(type) {
+				case map[string]interface{}:
+					for _, k := range sortedKeys(v) {
+						fmt.Fprintf(w, "%s[%s]: %s\n", mk[i], k, textValue(v[k]))
+					}
+				case []interface{}:
+					for n, e := range v {
+						fmt.Fprintf(w, "%s[%d]: %s\n", mk[i], n, textValue(e))
+					}
+				default:
+					fmt.Fprintf(w, "%s: %s\n", mk[i], textValue(v))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// printMetaFormatted prints metadata keys mk, all if empty, in JSON, YAML
+// or XML format of options.
+func (j *Job) printMetaFormatted(name string, metaMap amf0.EcmaArrayType, mk []string, w io.Writer) error {
+	meta := make(map[amf0.StringType]interface{})
+	for k, v := range metaMap {
+		if len(mk) == 0 || containsKey(mk, string(k)) {
+			meta[k] = v
+		}
+	}
+	switch j.opts.Format {
+	case FormatJSON:
+		if err := writeJSON(w, plainMap(meta)); err != nil {
+			return &OutputError{fileLocation(name), "", err}
+		}
+	case FormatYAML:
+		writeYAML(w, plainMap(meta), "")
+	case FormatXML:
+		fmt.Fprint(w, xmlHeader)
+		writeXMLFile(w, name, meta)
+		fmt.Fprint(w, xmlFooter)
+	}
+	return nil
+}
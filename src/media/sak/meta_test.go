@@ -0,0 +1,160 @@
+package sak
+
+import (
+	"bytes"
+	"github.com/metachord/amf.go/amf0"
+	"github.com/metachord/flv.go/flv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testTag struct {
+	tagType flv.TagType
+	dts     uint32
+	body    []byte
+}
+
+// writeTestFLV writes FLV file of tags of stream 0.
+func writeTestFLV(t *testing.T, name string, tags []testTag) {
+	var b bytes.Buffer
+	b.Write(hexBytes("464c5601 05 00000009 00000000"))
+	for _, tag := range tags {
+		n, d := len(tag.body), tag.dts
+		b.Write([]byte{byte(tag.tagType), byte(n >> 16), byte(n >> 8), byte(n), byte(d >> 16), byte(d >> 8), byte(d), byte(d >> 24), 0, 0, 0})
+		b.Write(tag.body)
+		n += 11
+		b.Write([]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+	}
+	if err := ioutil.WriteFile(name, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// keyframesTags returns tags with stale onMetaData at metaIndex, audio and
+// video tags precede the first keyframe.
+func keyframesTags(t *testing.T, metaIndex int) []testTag {
+	meta, err := encodeMeta(&amf0.EcmaArrayType{"duration": amf0.NumberType(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := []testTag{
+		{flv.TAG_TYPE_AUDIO, 0, hexBytes("2f fffb9064")},
+		{flv.TAG_TYPE_VIDEO, 0, hexBytes("27 01 000000 0000")},
+		{flv.TAG_TYPE_VIDEO, 40, hexBytes("17 01 000000 00000000")},
+		{flv.TAG_TYPE_AUDIO, 40, hexBytes("2f fffb9064")},
+		{flv.TAG_TYPE_VIDEO, 80, hexBytes("27 01 000000 0000")},
+		{flv.TAG_TYPE_VIDEO, 1040, hexBytes("17 01 000000 00000000")},
+	}
+	tags = append(tags[:metaIndex], append([]testTag{{flv.TAG_TYPE_META, 0, meta}}, tags[metaIndex:]...)...)
+	return tags
+}
+
+func countTags(t *testing.T, name string) (n int) {
+	r, err := OpenReader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	j := NewJob(DefaultOptions())
+	for {
+		frame, err := j.readFrame(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame == nil {
+			return n
+		}
+		n++
+	}
+}
+
+func TestCopyUpdateKeyframes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flvsak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "in.flv"), filepath.Join(dir, "out.flv")
+
+	// keyframes before and after the old onMetaData move by different sizes
+	for _, metaIndex := range []int{0, 1, 4} {
+		tags := keyframesTags(t, metaIndex)
+		writeTestFLV(t, in, tags)
+		if err := NewJob(DefaultOptions()).Copy(in, out, true); err != nil {
+			t.Fatal(err)
+		}
+		// new onMetaData replaces the old one, tags before the first
+		// keyframe are kept
+		if n := countTags(t, out); n != len(tags) {
+			t.Errorf("onMetaData at %d: %d tags written, want %d", metaIndex, n, len(tags))
+		}
+		var report bytes.Buffer
+		if err := NewJob(DefaultOptions()).VerifyIndex(out, &report); err != nil {
+			t.Errorf("onMetaData at %d: %s: %s", metaIndex, err, report.String())
+		}
+	}
+}
+
+// paddedTags returns keyframesTags with onMetaData padded by padding bytes
+// in front.
+func paddedTags(t *testing.T, padding int) []testTag {
+	meta := amf0.EcmaArrayType{"duration": amf0.NumberType(0)}
+	if err := addMetaPadding(meta, padding); err != nil {
+		t.Fatal(err)
+	}
+	body, err := encodeMeta(&meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := keyframesTags(t, 0)
+	tags[0].body = body
+	return tags
+}
+
+func TestUpdateInPlace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flvsak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "in.flv")
+
+	writeTestFLV(t, name, paddedTags(t, 1024))
+	before, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewJob(DefaultOptions()).UpdateInPlace(name); err != nil {
+		t.Fatal(err)
+	}
+	after, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only body of onMetaData changes, positions stay, padding fills the
+	// rest of the old tag
+	metaEnd := 13 + 11 + len(paddedTags(t, 1024)[0].body)
+	if len(after) != len(before) || !bytes.Equal(after[:24], before[:24]) || !bytes.Equal(after[metaEnd:], before[metaEnd:]) {
+		t.Errorf("file changed out of onMetaData body")
+	}
+	var report bytes.Buffer
+	if err := NewJob(DefaultOptions()).VerifyIndex(name, &report); err != nil {
+		t.Errorf("%s: %s", err, report.String())
+	}
+
+	// without room for new onMetaData the file is not touched
+	writeTestFLV(t, name, paddedTags(t, 0))
+	before, err = ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewJob(DefaultOptions()).UpdateInPlace(name)
+	if _, ok := err.(*MetadataError); !ok {
+		t.Errorf("update without padding returned %v, want MetadataError", err)
+	}
+	if after, _ := ioutil.ReadFile(name); !bytes.Equal(after, before) {
+		t.Errorf("file changed by failed update")
+	}
+}
@@ -0,0 +1,229 @@
+package sak
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/metachord/amf.go/amf0"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metaPaddingKey names string values of spaces reserving room in
+// onMetaData for in-place updates.
+const metaPaddingKey = "flvsakpadding"
+
+// metaPaddingOverhead is size of encoded padding key with empty string:
+// 16-bit length and name of key, string marker and 16-bit length.
+const metaPaddingOverhead = 2 + len(metaPaddingKey) + 3
+
+const maxAMFString = 0xffff
+
+// Types of values accepted by ParseMetaValue.
+const (
+	MetaString  = "string"
+	MetaNumber  = "number"
+	MetaBoolean = "boolean"
+	MetaDate    = "date"
+	MetaObject  = "object"
+	MetaArray   = "array"
+)
+
+// ParseMetaValue converts text to AMF0 value of type typ: string, number,
+// boolean, date in RFC 3339 format, object or array in JSON. Empty type
+// means string.
+func ParseMetaValue(typ, s string) (v interface{}, err error) {
+	switch typ {
+	case "", MetaString:
+		return amf0.StringType(s), nil
+	case MetaNumber:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		return amf0.NumberType(n), nil
+	case MetaBoolean:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, err
+		}
+		return amf0.BooleanType(b), nil
+	case MetaDate:
+		return parseMetaDate(s)
+	case MetaObject, MetaArray:
+		var jv interface{}
+		if err := json.Unmarshal([]byte(s), &jv); err != nil {
+			return nil, err
+		}
+		_, isObject := jv.(map[string]interface{})
+		_, isArray := jv.([]interface{})
+		if (typ == MetaObject && !isObject) || (typ == MetaArray && !isArray) {
+			return nil, fmt.Errorf("JSON value is not %s", typ)
+		}
+		return jsonToAMF(jv)
+	}
+	return nil, fmt.Errorf("unknown type %q", typ)
+}
+
+func parseMetaDate(s string) (interface{}, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, err
+	}
+	return amf0.DateType{TimeZone: 0, Date: float64(t.UnixNano()) / 1e6}, nil
+}
+
+// jsonToAMF converts decoded JSON to AMF0 value: objects become AMF objects
+// except {"$date": "RFC 3339 time"}, which becomes date, arrays become
+// strict arrays.
+func jsonToAMF(jv interface{}) (v interface{}, err error) {
+	switch jv := jv.(type) {
+	case string:
+		return amf0.StringType(jv), nil
+	case float64:
+		return amf0.NumberType(jv), nil
+	case bool:
+		return amf0.BooleanType(jv), nil
+	case []interface{}:
+		arr := make(amf0.StrictArrayType, len(jv))
+		for i, e := range jv {
+			if arr[i], err = jsonToAMF(e); err != nil {
+				return nil, err
+			}
+		}
+		return &arr, nil
+	case map[string]interface{}:
+		if d, ok := jv["$date"].(string); ok && len(jv) == 1 {
+			return parseMetaDate(d)
+		}
+		obj := make(amf0.ObjectType)
+		for k, e := range jv {
+			if obj[amf0.StringType(k)], err = jsonToAMF(e); err != nil {
+				return nil, fmt.Errorf("%s: %s", k, err)
+			}
+		}
+		return &obj, nil
+	case nil:
+		return nil, fmt.Errorf("null is not supported")
+	}
+	return nil, fmt.Errorf("unsupported JSON value %v", jv)
+}
+
+// LoadMetaJSON reads onMetaData values to set from JSON object of file name.
+func LoadMetaJSON(name string) (values map[string]interface{}, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, &InputError{fileLocation(name), err}
+	}
+	defer f.Close()
+	var jv map[string]interface{}
+	if err = json.NewDecoder(f).Decode(&jv); err != nil {
+		return nil, &InputError{fileLocation(name), err}
+	}
+	values = make(map[string]interface{})
+	for k, e := range jv {
+		if values[k], err = jsonToAMF(e); err != nil {
+			return nil, &InputError{fileLocation(name), fmt.Errorf("%s: %s", k, err)}
+		}
+	}
+	return values, nil
+}
+
+// mergeMeta copies keys of original onMetaData not computed by flvsak to
+// metadata, keys out of MergeMetaKeys (when set) or in DropMetaKeys are not
+// copied.
+func (j *Job) mergeMeta(metaMap amf0.EcmaArrayType, oldMeta map[amf0.StringType]interface{}) {
+	for k, v := range oldMeta {
+		if _, ok := metaMap[k]; ok || strings.HasPrefix(string(k), metaPaddingKey) {
+			continue
+		}
+		if len(j.opts.MergeMetaKeys) > 0 && !containsKey(j.opts.MergeMetaKeys, string(k)) {
+			continue
+		}
+		if containsKey(j.opts.DropMetaKeys, string(k)) {
+			continue
+		}
+		metaMap[k] = v
+	}
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// addMetaPadding adds padding keys taking exactly size bytes of encoded
+// onMetaData.
+func addMetaPadding(metaMap amf0.EcmaArrayType, size int) error {
+	paddingName := func(i int) string {
+		if i == 0 {
+			return metaPaddingKey
+		}
+		return fmt.Sprintf("%s%d", metaPaddingKey, i)
+	}
+	// key is 16-bit length and name, value is marker, 16-bit length and spaces
+	overhead := func(i int) int { return 2 + len(paddingName(i)) + 3 }
+	for i := 0; size > 0; i++ {
+		n := size - overhead(i)
+		if n < 0 {
+			return fmt.Errorf("no room for padding key in %d bytes", size)
+		}
+		if n > maxAMFString {
+			n = maxAMFString
+			if rest := size - overhead(i) - n; rest < overhead(i+1) {
+				n -= overhead(i+1) - rest
+			}
+		}
+		metaMap[amf0.StringType(paddingName(i))] = amf0.StringType(strings.Repeat(" ", n))
+		size -= overhead(i) + n
+	}
+	return nil
+}
+
+// fitMeta encodes onMetaData taking exactly size bytes. Metadata keeps
+// one padding key, empty when there is no room left, and its string is
+// resized to fill the rest, so any metadata not larger than size with
+// empty padding key fits. Metadata exactly of size without padding key
+// fits too.
+func fitMeta(metaMap *amf0.EcmaArrayType, size int) (body []byte, err error) {
+	for k := range *metaMap {
+		if strings.HasPrefix(string(k), metaPaddingKey) {
+			delete(*metaMap, k)
+		}
+	}
+	if body, err = encodeMeta(metaMap); err != nil {
+		return nil, err
+	}
+	if len(body) == size {
+		return body, nil
+	}
+	free := size - len(body)
+	if free < metaPaddingOverhead {
+		return nil, fmt.Errorf("new onMetaData with padding key is %d bytes larger than old one, copy the file reserving padding", metaPaddingOverhead-free)
+	}
+	if err = addMetaPadding(*metaMap, free); err != nil {
+		return nil, err
+	}
+	return encodeMeta(metaMap)
+}
+
+// editMeta applies MetaDelete and MetaSet of options to metadata.
+func (j *Job) editMeta(metaMap amf0.EcmaArrayType) {
+	for _, k := range j.opts.MetaDelete {
+		delete(metaMap, amf0.StringType(k))
+	}
+	for k, v := range j.opts.MetaSet {
+		metaMap[amf0.StringType(k)] = v
+	}
+}
+
+// metaEdited reports whether key of metadata is set or deleted by options.
+func (j *Job) metaEdited(key string) bool {
+	_, ok := j.opts.MetaSet[key]
+	return ok || containsKey(j.opts.MetaDelete, key)
+}
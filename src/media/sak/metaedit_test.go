@@ -0,0 +1,106 @@
+package sak
+
+import (
+	"github.com/metachord/amf.go/amf0"
+	"strings"
+	"testing"
+)
+
+func testMeta(title string) *amf0.EcmaArrayType {
+	return &amf0.EcmaArrayType{
+		"duration":  amf0.NumberType(12.5),
+		"title":     amf0.StringType(title),
+		"hasVideo":  amf0.BooleanType(true),
+		"videosize": amf0.NumberType(1024),
+	}
+}
+
+func TestFitMetaGaps(t *testing.T) {
+	for gap := 0; gap <= 20; gap++ {
+		empty := testMeta("title")
+		(*empty)[metaPaddingKey] = amf0.StringType("")
+		base, err := encodeMeta(empty)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := len(base) + gap
+
+		// old metadata was padded to size, new one came from merge without
+		// padding keys
+		meta := testMeta("title")
+		body, err := fitMeta(meta, size)
+		if err != nil {
+			t.Errorf("gap %d: %s", gap, err)
+			continue
+		}
+		if len(body) != size {
+			t.Errorf("gap %d: body is %d bytes, want %d", gap, len(body), size)
+		}
+		if pad := (*meta)[metaPaddingKey]; pad != amf0.StringType(strings.Repeat(" ", gap)) {
+			t.Errorf("gap %d: padding is %q", gap, pad)
+		}
+	}
+}
+
+func TestFitMetaPaddedFile(t *testing.T) {
+	// file copied with padding, title grows and shrinks a bit
+	old := testMeta("title")
+	if err := addMetaPadding(*old, 40); err != nil {
+		t.Fatal(err)
+	}
+	oldBody, err := encodeMeta(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n <= len("title")+40-metaPaddingOverhead; n++ {
+		meta := testMeta(strings.Repeat("t", n))
+		body, err := fitMeta(meta, len(oldBody))
+		if err != nil {
+			t.Errorf("title of %d: %s", n, err)
+			continue
+		}
+		if len(body) != len(oldBody) {
+			t.Errorf("title of %d: body is %d bytes, want %d", n, len(body), len(oldBody))
+		}
+	}
+}
+
+func TestFitMetaExact(t *testing.T) {
+	meta := testMeta("title")
+	body, err := encodeMeta(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fit, err := fitMeta(testMeta("title"), len(body)); err != nil || len(fit) != len(body) {
+		t.Errorf("exact size: %d bytes, %v", len(fit), err)
+	}
+	for free := 1; free < metaPaddingOverhead; free++ {
+		if _, err := fitMeta(testMeta("title"), len(body)+free); err == nil {
+			t.Errorf("%d free bytes: no error", free)
+		}
+	}
+	if _, err := fitMeta(testMeta("title"), len(body)-1); err == nil {
+		t.Error("larger metadata: no error")
+	}
+}
+
+func TestAddMetaPaddingLarge(t *testing.T) {
+	for _, size := range []int{metaPaddingOverhead, maxAMFString, maxAMFString + metaPaddingOverhead + 1, 3 * maxAMFString} {
+		meta := testMeta("title")
+		body, err := encodeMeta(meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := addMetaPadding(*meta, size); err != nil {
+			t.Errorf("size %d: %s", size, err)
+			continue
+		}
+		padded, err := encodeMeta(meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(padded)-len(body) != size {
+			t.Errorf("size %d: padding takes %d bytes", size, len(padded)-len(body))
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package sak
+
+import (
+	"fmt"
+)
+
+// nalUnit describes NAL unit of AVC or HEVC coded frame.
+type nalUnit struct {
+	Type int    `json:"type"`
+	Name string `json:"name,omitempty"`
+	Size int    `json:"size"`
+	// RefIdc is nal_ref_idc of AVC unit, nil for HEVC.
+	RefIdc *int `json:"ref_idc,omitempty"`
+}
+
+var avcNALNames = map[int]string{
+	1:  "non-IDR slice",
+	2:  "slice data A",
+	3:  "slice data B",
+	4:  "slice data C",
+	5:  "IDR slice",
+	6:  "SEI",
+	7:  "SPS",
+	8:  "PPS",
+	9:  "AUD",
+	10: "end of sequence",
+	11: "end of stream",
+	12: "filler",
+}
+
+var hevcNALNames = map[int]string{
+	0:  "TRAIL_N",
+	1:  "TRAIL_R",
+	2:  "TSA_N",
+	3:  "TSA_R",
+	4:  "STSA_N",
+	5:  "STSA_R",
+	6:  "RADL_N",
+	7:  "RADL_R",
+	8:  "RASL_N",
+	9:  "RASL_R",
+	16: "BLA_W_LP",
+	17: "BLA_W_RADL",
+	18: "BLA_N_LP",
+	19: "IDR_W_RADL",
+	20: "IDR_N_LP",
+	21: "CRA",
+	32: "VPS",
+	33: "SPS",
+	34: "PPS",
+	35: "AUD",
+	36: "EOS",
+	37: "EOB",
+	38: "FD",
+	39: "prefix SEI",
+	40: "suffix SEI",
+}
+
+// nalLengthSize returns size of NAL unit length prefix from AVC or HEVC
+// decoder configuration record.
+func nalLengthSize(config []byte, hevc bool) (size int, err error) {
+	if !hevc {
+		c, err := ParseAVCConfig(config)
+		if err != nil {
+			return 0, err
+		}
+		return c.NALLengthSize, nil
+	}
+	if len(config) < 23 {
+		return 0, errShortData
+	}
+	return int(config[21]&0x03) + 1, nil
+}
+
+// splitNALUnits returns NAL units of length-prefixed data of AVC or HEVC
+// coded frame, units found before error are returned with it.
+func splitNALUnits(data []byte, lengthSize int, hevc bool) (units []nalUnit, err error) {
+	for pos := 0; pos < len(data); {
+		if pos+lengthSize > len(data) {
+			return units, fmt.Errorf("NAL unit length at %d: %s", pos, errShortData)
+		}
+		size := 0
+		for _, b := range data[pos : pos+lengthSize] {
+			size = size<<8 | int(b)
+		}
+		pos += lengthSize
+		if size == 0 || pos+size > len(data) {
+			return units, fmt.Errorf("NAL unit of %d bytes at %d does not fit in %d bytes", size, pos, len(data))
+		}
+		u := nalUnit{Size: size}
+		if hevc {
+			u.Type = int(data[pos]>>1) & 0x3f
+			u.Name = hevcNALNames[u.Type]
+		} else {
+			u.Type = int(data[pos] & 0x1f)
+			u.Name = avcNALNames[u.Type]
+			refIdc := int(data[pos]>>5) & 0x03
+			u.RefIdc = &refIdc
+		}
+		units = append(units, u)
+		pos += size
+	}
+	return units, nil
+}
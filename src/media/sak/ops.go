@@ -0,0 +1,325 @@
+package sak
+
+import (
+	"errors"
+	"github.com/metachord/flv.go/flv"
+	"io"
+	"os"
+)
+
+func allTypes(w *flv.FlvWriter) map[flv.TagType]*flv.FlvWriter {
+	return map[flv.TagType]*flv.FlvWriter{
+		flv.TAG_TYPE_VIDEO: w,
+		flv.TAG_TYPE_AUDIO: w,
+		flv.TAG_TYPE_META:  w,
+	}
+}
+
+// end closes outputs of operation. When operation failed its outputs are
+// removed unless KeepPartial is set, stream files of SplitStreams are
+// closed and kept as they are complete.
+func (j *Job) end(err *error) {
+	j.closeSplitWriters()
+	for _, fd := range j.outputs {
+		if cerr := fd.Close(); cerr != nil && *err == nil {
+			*err = &OutputError{fileLocation(""), fd.Name(), cerr}
+		}
+	}
+	if *err != nil && !j.opts.KeepPartial {
+		for _, fd := range j.outputs {
+			j.logf("Remove partial output: %s", fd.Name())
+			os.Remove(fd.Name())
+		}
+	}
+	j.outputs = nil
+}
+
+// createOutput creates output file of operation and writes FLV header to it.
+func (j *Job) createOutput(name string, header *flv.Header) (w *flv.FlvWriter, err error) {
+	outF, err := os.Create(name)
+	if err != nil {
+		return nil, &OutputError{fileLocation(""), name, err}
+	}
+	j.outputs = append(j.outputs, outF)
+	w = flv.NewWriter(outF)
+	err = w.WriteHeader(header)
+	if err != nil {
+		return nil, &OutputError{fileLocation(""), name, err}
+	}
+	return w, nil
+}
+
+// Copy writes frames of inFile to outFile. With updateKeyframes new
+// onMetaData with keyframes index is written first and replaces the first
+// onMetaData of input, other tags are copied as they are.
+func (j *Job) Copy(inFile, outFile string, updateKeyframes bool) (err error) {
+	j.reset()
+	defer j.end(&err)
+
+	r, err := OpenReader(inFile)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	j.header = r.Header
+
+	frWriter, err := j.createOutput(outFile, r.Header)
+	if err != nil {
+		return err
+	}
+
+	if updateKeyframes {
+		oldMeta, err := j.WriteMetaKeyframes(r, frWriter)
+		if err != nil {
+			return err
+		}
+		err = r.Rewind()
+		if err != nil {
+			return err
+		}
+		j.replacedMeta = oldMeta
+	}
+
+	_, err = j.WriteFrames(r, allTypes(frWriter), 0)
+	return err
+}
+
+// UpdateInPlace replaces the first onMetaData tag of file with new one
+// with keyframes index without copying the file. New tag must not be larger
+// than the old one, the rest of it is filled with padding key, see fitMeta;
+// the rest of the file is not touched.
+func (j *Job) UpdateInPlace(file string) (err error) {
+	j.reset()
+	j.inPlace = true
+	defer j.end(&err)
+	if len(j.opts.CuePoints) > 0 {
+		return optionsErrorf("cue points can not be inserted in place")
+	}
+
+	f, err := os.OpenFile(file, os.O_RDWR, 0)
+	if err != nil {
+		return &InputError{fileLocation(file), err}
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		return err
+	}
+	j.header = r.Header
+
+	metaMap, stats, err := j.createMeta(r)
+	if err != nil {
+		return err
+	}
+	if stats.oldMetaPosition < 0 {
+		return &MetadataError{fileLocation(file), errors.New("no onMetaData to update in place")}
+	}
+	loc := Location{File: file, Offset: stats.oldMetaPosition, Index: -1}
+
+	body, err := fitMeta(metaMap, stats.oldMetaBodySize)
+	if err != nil {
+		return &MetadataError{loc, err}
+	}
+
+	_, err = f.WriteAt(body, stats.oldMetaPosition+int64(flv.TAG_HEADER_LENGTH))
+	if err != nil {
+		return &OutputError{loc, file, err}
+	}
+	return nil
+}
+
+// SplitContent writes frames of inFile to files selected by tag type. Types
+// mapped to the same file name share one output, types with empty name are
+// dropped.
+func (j *Job) SplitContent(inFile string, outc map[flv.TagType]string) (err error) {
+	j.reset()
+	defer j.end(&err)
+
+	if outc[flv.TAG_TYPE_VIDEO] == "" && outc[flv.TAG_TYPE_AUDIO] == "" && outc[flv.TAG_TYPE_META] == "" {
+		return optionsErrorf("no any split output file")
+	}
+
+	r, err := OpenReader(inFile)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	j.header = r.Header
+
+	frW := make(map[flv.TagType]*flv.FlvWriter)
+	byName := make(map[string]*flv.FlvWriter)
+	for _, k := range []flv.TagType{flv.TAG_TYPE_VIDEO, flv.TAG_TYPE_AUDIO, flv.TAG_TYPE_META} {
+		of := outc[k]
+		if of == "" {
+			// Drop frames of this type
+			frW[k] = nil
+			continue
+		}
+		if w, ok := byName[of]; ok {
+			j.logf("Write %s to existing file %s", k, of)
+			frW[k] = w
+			continue
+		}
+		j.logf("Write %s to %s", k, of)
+		w, err := j.createOutput(of, r.Header)
+		if err != nil {
+			return err
+		}
+		byName[of] = w
+		frW[k] = w
+	}
+
+	_, err = j.WriteFrames(r, frW, 0)
+	return err
+}
+
+// Concat writes frames of inFiles one after another to outFile, dts of
+// every next file continue from the last dts of previous one.
+func (j *Job) Concat(inFiles []string, outFile string) (err error) {
+	j.reset()
+	defer j.end(&err)
+
+	j.logf("Concat files: %#v", inFiles)
+	var frW *flv.FlvWriter
+	offset := 0
+	for _, fn := range inFiles {
+		r, err := OpenReader(fn)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		if frW == nil {
+			// write header to output after read of first file
+			frW, err = j.createOutput(outFile, r.Header)
+			if err != nil {
+				return err
+			}
+			j.header = r.Header
+		}
+
+		offset, err = j.WriteFrames(r, allTypes(frW), offset)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Info prints metadata regenerated from inFile to w.
+func (j *Job) Info(inFile string, keys []string, w io.Writer) (err error) {
+	j.reset()
+	defer j.end(&err)
+
+	r, err := OpenReader(inFile)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	j.header = r.Header
+	return j.PrintMetaData(r, keys, w)
+}
+
+// Dump prints frames of inFile between MinDts and MaxDts selected by Dump
+// filter of options to w as text lines, as records of FormatJSONL or
+// FormatCSV, or as checksums of FormatFrameHash of options.
+func (j *Job) Dump(inFile string, w io.Writer) (err error) {
+	j.reset()
+	defer j.end(&err)
+
+	out, err := newDumpOutput(j.opts, w)
+	if err != nil {
+		return err
+	}
+	r, err := OpenReader(inFile)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	j.header = r.Header
+	for {
+		frame, err := j.readFrame(r)
+		if err != nil {
+			return err
+		}
+		if frame == nil {
+			break
+		}
+		stop, err := j.frameDump(frame, r.Location(), out)
+		if err != nil {
+			return err
+		}
+		if stop {
+			break
+		}
+	}
+	if err := out.flush(); err != nil {
+		return &OutputError{fileLocation(inFile), "", err}
+	}
+	return nil
+}
+
+// Find prints tags of inFile matching q to w the way Dump prints them, or
+// writes them to outFile with FLV header of input when outFile is not
+// empty. Limit of Dump filter of options stops search after that many
+// matches.
+func (j *Job) Find(inFile, outFile string, q *Query, w io.Writer) (err error) {
+	j.reset()
+	defer j.end(&err)
+
+	out, err := newDumpOutput(j.opts, w)
+	if err != nil {
+		return err
+	}
+	r, err := OpenReader(inFile)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	j.header = r.Header
+
+	var frWriter *flv.FlvWriter
+	if outFile != "" {
+		if frWriter, err = j.createOutput(outFile, r.Header); err != nil {
+			return err
+		}
+	}
+	lastDts := make(map[streamKey]uint32)
+	found := 0
+	for {
+		frame, err := j.readFrame(r)
+		if err != nil {
+			return err
+		}
+		if frame == nil {
+			break
+		}
+		key := streamKey{frame.GetType(), frame.GetStream()}
+		prevDts, hasPrev := lastDts[key]
+		lastDts[key] = frame.GetDts()
+		if !q.match(frame, r.Location(), prevDts, hasPrev) {
+			out.observe(frame)
+			continue
+		}
+		if frWriter == nil {
+			stop, err := j.frameDump(frame, r.Location(), out)
+			if err != nil {
+				return err
+			}
+			if stop {
+				break
+			}
+			continue
+		}
+		if err := j.writeFrame(r, frWriter, frame); err != nil {
+			return err
+		}
+		found++
+		if j.opts.Dump.Limit > 0 && found >= j.opts.Dump.Limit {
+			break
+		}
+	}
+	if err := out.flush(); err != nil {
+		return &OutputError{fileLocation(inFile), "", err}
+	}
+	return nil
+}
@@ -0,0 +1,412 @@
+package sak
+
+import (
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"strconv"
+	"strings"
+)
+
+// Fields of tags in Query expressions.
+const (
+	FieldType     = "type"
+	FieldStream   = "stream"
+	FieldDts      = "dts"
+	FieldSize     = "size"
+	FieldKeyframe = "keyframe"
+	FieldCodec    = "codec"
+	FieldDelta    = "delta"
+	FieldEvent    = "event"
+	FieldOffset   = "offset"
+	FieldIndex    = "index"
+)
+
+type fieldKind int
+
+const (
+	numberField fieldKind = iota
+	stringField
+	boolField
+)
+
+var queryFields = map[string]fieldKind{
+	FieldType:     stringField,
+	FieldStream:   numberField,
+	FieldDts:      numberField,
+	FieldSize:     numberField,
+	FieldKeyframe: boolField,
+	FieldCodec:    stringField,
+	FieldDelta:    numberField,
+	FieldEvent:    stringField,
+	FieldOffset:   numberField,
+	FieldIndex:    numberField,
+}
+
+// Query is predicate over tag fields:
+//
+//	type == video and size > 200k
+//	type == audio and delta > 100
+//	type == meta and event != onMetaData
+//	keyframe and (codec == AVC or codec == hvc1)
+//
+// Comparisons are ==, !=, <, <=, > and >=, strings allow only == and !=.
+// Numbers take k and m suffixes multiplying them by 1024 and 1024*1024.
+// Strings are quoted when they have spaces or operator characters. codec
+// matches codec id, FourCC or codec name ignoring case, delta is dts
+// difference to the previous tag of the same type and stream and matches
+// nothing for the first tag. Terms combine with and, or, not (&&, ||, !)
+// and parentheses.
+type Query struct {
+	src  string
+	root queryNode
+}
+
+// String returns source of query.
+func (q *Query) String() string {
+	return q.src
+}
+
+// queryTag holds fields of tag matched by Query.
+type queryTag struct {
+	typ, codec, codecName, event string
+	stream, dts, size            int64
+	offset, index, delta         int64
+	keyframe, hasDelta           bool
+}
+
+// newQueryTag returns fields of frame read at loc, prevDts is dts of the
+// previous tag of its stream if hasPrev is set.
+func newQueryTag(fr flv.Frame, loc Location, prevDts uint32, hasPrev bool) *queryTag {
+	t := &queryTag{
+		typ:      tagTypeName(fr.GetType()),
+		stream:   int64(fr.GetStream()),
+		dts:      int64(fr.GetDts()),
+		size:     int64(len(*fr.GetBody())),
+		offset:   loc.Offset,
+		index:    int64(loc.Index),
+		delta:    int64(fr.GetDts()) - int64(prevDts),
+		hasDelta: hasPrev,
+	}
+	if vt := videoTag(fr); vt != nil {
+		t.codec, t.codecName = vt.Codec(), videoCodecNames[vt.Codec()]
+		t.keyframe = vt.IsKeyFrame()
+	} else if at := audioTag(fr); at != nil {
+		t.codec, t.codecName = at.Codec(), audioCodecNames[at.Codec()]
+	} else if name, ok := scriptEvent(fr); ok {
+		t.event = name
+	}
+	return t
+}
+
+// match reports whether frame read at loc matches query, see newQueryTag
+// for prevDts and hasPrev.
+func (q *Query) match(fr flv.Frame, loc Location, prevDts uint32, hasPrev bool) bool {
+	return q.root.match(newQueryTag(fr, loc, prevDts, hasPrev))
+}
+
+type queryNode interface {
+	match(t *queryTag) bool
+}
+
+type queryAnd struct{ a, b queryNode }
+type queryOr struct{ a, b queryNode }
+type queryNot struct{ a queryNode }
+
+func (n *queryAnd) match(t *queryTag) bool { return n.a.match(t) && n.b.match(t) }
+func (n *queryOr) match(t *queryTag) bool  { return n.a.match(t) || n.b.match(t) }
+func (n *queryNot) match(t *queryTag) bool { return !n.a.match(t) }
+
+// queryCmp compares field with value, num for number and bool fields (1 is
+// true), str for string fields.
+type queryCmp struct {
+	field string
+	op    string
+	num   int64
+	str   string
+}
+
+func (n *queryCmp) match(t *queryTag) bool {
+	switch queryFields[n.field] {
+	case stringField:
+		var eq bool
+		switch n.field {
+		case FieldType:
+			eq = strings.EqualFold(t.typ, n.str)
+		case FieldCodec:
+			eq = t.codec != "" && (strings.EqualFold(t.codec, n.str) || strings.EqualFold(t.codecName, n.str))
+		case FieldEvent:
+			eq = t.event == n.str
+		}
+		return eq == (n.op == "==")
+	case boolField:
+		var v int64
+		if t.keyframe {
+			v = 1
+		}
+		return compareNumbers(v, n.op, n.num)
+	}
+	var v int64
+	switch n.field {
+	case FieldStream:
+		v = t.stream
+	case FieldDts:
+		v = t.dts
+	case FieldSize:
+		v = t.size
+	case FieldOffset:
+		v = t.offset
+	case FieldIndex:
+		v = t.index
+	case FieldDelta:
+		if !t.hasDelta {
+			return false
+		}
+		v = t.delta
+	}
+	return compareNumbers(v, n.op, n.num)
+}
+
+func compareNumbers(a int64, op string, b int64) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+// queryToken is word, quoted string or operator of query source.
+type queryToken struct {
+	text   string
+	quoted bool
+	pos    int
+}
+
+// ParseQuery parses query expression, see Query.
+func ParseQuery(src string) (q *Query, err error) {
+	toks, err := lexQuery(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{src: src, toks: toks}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if tok, ok := p.peek(); ok {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	return &Query{src: src, root: root}, nil
+}
+
+var queryOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "=", "<", ">", "!", "(", ")"}
+
+func lexQuery(src string) (toks []queryToken, err error) {
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+			continue
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(src[i+1:], c)
+			if end < 0 {
+				return nil, optionsErrorf("query: unterminated string at %d", i+1)
+			}
+			toks = append(toks, queryToken{src[i+1 : i+1+end], true, i + 1})
+			i += end + 2
+			continue
+		}
+		op := ""
+		for _, o := range queryOperators {
+			if strings.HasPrefix(src[i:], o) {
+				op = o
+				break
+			}
+		}
+		if op != "" {
+			if op == "=" {
+				toks = append(toks, queryToken{"==", false, i + 1})
+			} else {
+				toks = append(toks, queryToken{op, false, i + 1})
+			}
+			i += len(op)
+			continue
+		}
+		start := i
+		for i < len(src) && !strings.ContainsRune(" \t\n\"'=!<>&|()", rune(src[i])) {
+			i++
+		}
+		if i == start {
+			return nil, optionsErrorf("query: unexpected %q at %d", src[i], i+1)
+		}
+		toks = append(toks, queryToken{src[start:i], false, start + 1})
+	}
+	return toks, nil
+}
+
+type queryParser struct {
+	src  string
+	toks []queryToken
+	pos  int
+}
+
+func (p *queryParser) peek() (tok queryToken, ok bool) {
+	if p.pos >= len(p.toks) {
+		return queryToken{pos: len(p.src) + 1}, false
+	}
+	return p.toks[p.pos], true
+}
+
+// accept consumes the next token if it is one of unquoted words, compared
+// ignoring case.
+func (p *queryParser) accept(words ...string) bool {
+	tok, ok := p.peek()
+	if !ok || tok.quoted {
+		return false
+	}
+	for _, w := range words {
+		if strings.EqualFold(tok.text, w) {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *queryParser) errorf(tok queryToken, format string, v ...interface{}) error {
+	return optionsErrorf("query: %s at %d", fmt.Sprintf(format, v...), tok.pos)
+}
+
+func (p *queryParser) or() (queryNode, error) {
+	n, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or", "||") {
+		b, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		n = &queryOr{n, b}
+	}
+	return n, nil
+}
+
+func (p *queryParser) and() (queryNode, error) {
+	n, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and", "&&") {
+		b, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		n = &queryAnd{n, b}
+	}
+	return n, nil
+}
+
+func (p *queryParser) not() (queryNode, error) {
+	if p.accept("not", "!") {
+		n, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &queryNot{n}, nil
+	}
+	return p.term()
+}
+
+func (p *queryParser) term() (queryNode, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, p.errorf(tok, "unexpected end")
+	}
+	if p.accept("(") {
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			tok, _ := p.peek()
+			return nil, p.errorf(tok, "missing )")
+		}
+		return n, nil
+	}
+	field := strings.ToLower(tok.text)
+	kind, known := queryFields[field]
+	if tok.quoted || !known {
+		return nil, p.errorf(tok, "unknown field %q", tok.text)
+	}
+	p.pos++
+	opTok, _ := p.peek()
+	if !p.accept("==", "!=", "<", "<=", ">", ">=") {
+		if kind == boolField {
+			return &queryCmp{field: field, op: "==", num: 1}, nil
+		}
+		return nil, p.errorf(opTok, "%s needs comparison", field)
+	}
+	op := opTok.text
+	valTok, ok := p.peek()
+	if !ok || (!valTok.quoted && strings.ContainsAny(valTok.text, "=!<>&|()")) {
+		return nil, p.errorf(valTok, "%s %s needs value", field, op)
+	}
+	p.pos++
+	n := &queryCmp{field: field, op: op}
+	switch kind {
+	case stringField:
+		if op != "==" && op != "!=" {
+			return nil, p.errorf(opTok, "%s allows only == and !=", field)
+		}
+		n.str = valTok.text
+	case boolField:
+		b, err := strconv.ParseBool(valTok.text)
+		if err != nil {
+			return nil, p.errorf(valTok, "%s needs true or false", field)
+		}
+		if op != "==" && op != "!=" {
+			return nil, p.errorf(opTok, "%s allows only == and !=", field)
+		}
+		if b {
+			n.num = 1
+		}
+	default:
+		num, err := parseQueryNumber(valTok.text)
+		if err != nil {
+			return nil, p.errorf(valTok, "%s needs number, not %q", field, valTok.text)
+		}
+		n.num = num
+	}
+	return n, nil
+}
+
+// parseQueryNumber parses integer with optional k, kb, m or mb suffix.
+func parseQueryNumber(s string) (int64, error) {
+	mult := int64(1)
+	lower := strings.ToLower(s)
+	for _, sfx := range []struct {
+		s    string
+		mult int64
+	}{{"kb", 1 << 10}, {"k", 1 << 10}, {"mb", 1 << 20}, {"m", 1 << 20}} {
+		if strings.HasSuffix(lower, sfx.s) {
+			lower, mult = strings.TrimSuffix(lower, sfx.s), sfx.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * mult, nil
+}
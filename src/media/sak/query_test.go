@@ -0,0 +1,191 @@
+package sak
+
+import (
+	"github.com/metachord/flv.go/flv"
+	"testing"
+)
+
+func TestQueryPrecedence(t *testing.T) {
+	// a is stream == 1, b is keyframe, c is size > 100
+	tests := []struct {
+		src  string
+		want func(a, b, c bool) bool
+	}{
+		{"not stream == 1 and keyframe or size > 100", func(a, b, c bool) bool { return (!a && b) || c }},
+		{"stream == 1 or keyframe and size > 100", func(a, b, c bool) bool { return a || (b && c) }},
+		{"not (stream == 1 and keyframe or size > 100)", func(a, b, c bool) bool { return !(a && b || c) }},
+		{"(stream == 1 or keyframe) and size > 100", func(a, b, c bool) bool { return (a || b) && c }},
+		{"! stream == 1 && keyframe || size > 100", func(a, b, c bool) bool { return (!a && b) || c }},
+		{"not not stream == 1 and not keyframe", func(a, b, c bool) bool { return a && !b }},
+		{"STREAM = 1 AND Keyframe == true OR size>100", func(a, b, c bool) bool { return (a && b) || c }},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.src)
+		if err != nil {
+			t.Errorf("%s: %s", tt.src, err)
+			continue
+		}
+		for i := 0; i < 8; i++ {
+			a, b, c := i&1 != 0, i&2 != 0, i&4 != 0
+			tag := &queryTag{typ: "video", size: 50, keyframe: b}
+			if a {
+				tag.stream = 1
+			}
+			if c {
+				tag.size = 200
+			}
+			if got, want := q.root.match(tag), tt.want(a, b, c); got != want {
+				t.Errorf("%s with a=%v b=%v c=%v: got %v, want %v", tt.src, a, b, c, got, want)
+			}
+		}
+	}
+}
+
+// metaFrame returns script tag of event with no arguments.
+func metaFrame(event string, dts uint32) flv.Frame {
+	body := []byte{0x02, byte(len(event) >> 8), byte(len(event))}
+	body = append(body, event...)
+	return flv.MetaFrame{CFrame: &flv.CFrame{Dts: dts, Type: flv.TAG_TYPE_META, Flavor: flv.METADATA, Body: body}}
+}
+
+// avcFrame returns AVC NALU video tag.
+func avcFrame(keyframe bool, dts uint32, size int) flv.Frame {
+	body := make([]byte, size)
+	body[0], body[1] = 0x27, avcNALU
+	flavor := flv.FRAME
+	if keyframe {
+		body[0], flavor = 0x17, flv.KEYFRAME
+	}
+	return flv.VideoFrame{CFrame: &flv.CFrame{Dts: dts, Type: flv.TAG_TYPE_VIDEO, Flavor: flavor, Body: body}}
+}
+
+func TestQueryMatch(t *testing.T) {
+	loc := Location{File: "in.flv", Offset: 13, Index: 0}
+	access := metaFrame("|RtmpSampleAccess", 0)
+	spaced := metaFrame("a and (b)", 0)
+	key := avcFrame(true, 40, 300*1024)
+	inter := avcFrame(false, 80, 100)
+	tests := []struct {
+		src   string
+		frame flv.Frame
+		want  bool
+	}{
+		{"event == '|RtmpSampleAccess'", access, true},
+		{`event == "|RtmpSampleAccess"`, access, true},
+		{"event != '|RtmpSampleAccess'", access, false},
+		{"event == 'a and (b)'", spaced, true},
+		{"event == 'a and (b)' or type == video", access, false},
+		{"type == meta and event != onMetaData", access, true},
+		{"type == video and size > 200k", key, true},
+		{"type == video and size > 200k", inter, false},
+		{"size <= 300kb", key, true},
+		{"keyframe and codec == avc", key, true},
+		{"keyframe and codec == 'AVC'", key, true},
+		{"codec == 7", inter, true},
+		{"codec == avc", access, false},
+		{"not keyframe", inter, true},
+		{"keyframe == false", inter, true},
+		{"dts >= 40 and dts < 80", key, true},
+		{"offset == 13 and index == 0 and stream == 0", key, true},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.src)
+		if err != nil {
+			t.Errorf("%s: %s", tt.src, err)
+			continue
+		}
+		if got := q.match(tt.frame, loc, 0, false); got != tt.want {
+			t.Errorf("%s on %s: got %v, want %v", tt.src, tt.frame, got, tt.want)
+		}
+	}
+}
+
+func TestQueryDelta(t *testing.T) {
+	loc := Location{Offset: 13, Index: 0}
+	first := avcFrame(true, 1000, 10)
+	tests := []struct {
+		src           string
+		first, second bool
+	}{
+		{"delta > 100", false, true},
+		{"delta == 1000", false, false},
+		{"delta <= 100", false, false},
+		{"delta >= 0", false, true},
+		{"not delta > 100", true, false},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.src)
+		if err != nil {
+			t.Errorf("%s: %s", tt.src, err)
+			continue
+		}
+		// dts of the first tag is not a difference to anything
+		if got := q.match(first, loc, 0, false); got != tt.first {
+			t.Errorf("%s on the first tag: got %v, want %v", tt.src, got, tt.first)
+		}
+		if got := q.match(avcFrame(false, 1200, 10), loc, 1000, true); got != tt.second {
+			t.Errorf("%s on the second tag: got %v, want %v", tt.src, got, tt.second)
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	tests := []struct {
+		src, msg string
+	}{
+		{"", "query: unexpected end at 1"},
+		{"foo == 1", `query: unknown field "foo" at 1`},
+		{"'type' == video", `query: unknown field "type" at 1`},
+		{"(type == video and size > 10", "query: missing ) at 29"},
+		{"size > x", `query: size needs number, not "x" at 8`},
+		{"size > 10q", `query: size needs number, not "10q" at 8`},
+		{"type > video", "query: type allows only == and != at 6"},
+		{"keyframe < true", "query: keyframe allows only == and != at 10"},
+		{"keyframe == yes", "query: keyframe needs true or false at 13"},
+		{"type == video size", `query: unexpected "size" at 15`},
+		{"size", "query: size needs comparison at 5"},
+		{"size >", "query: size > needs value at 7"},
+		{"size > )", "query: size > needs value at 8"},
+		{"event == 'onMetaData", "query: unterminated string at 10"},
+		{"type == video and", "query: unexpected end at 18"},
+		{"type == video & dts", `query: unexpected '&' at 15`},
+	}
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.src)
+		if err == nil {
+			t.Errorf("%q: no error", tt.src)
+			continue
+		}
+		if _, ok := err.(*OptionsError); !ok {
+			t.Errorf("%q: %T is not OptionsError", tt.src, err)
+		}
+		if err.Error() != tt.msg {
+			t.Errorf("%q: got %q, want %q", tt.src, err, tt.msg)
+		}
+	}
+}
+
+func TestParseQueryNumber(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+	}{
+		{"0", 0},
+		{"100", 100},
+		{"-5", -5},
+		{"2k", 2048},
+		{"2KB", 2048},
+		{"3m", 3 << 20},
+		{"1mb", 1 << 20},
+	}
+	for _, tt := range tests {
+		if n, err := parseQueryNumber(tt.s); err != nil || n != tt.want {
+			t.Errorf("%s: got %d, %v, want %d", tt.s, n, err, tt.want)
+		}
+	}
+	for _, s := range []string{"", "k", "1.5k", "1g"} {
+		if _, err := parseQueryNumber(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+}
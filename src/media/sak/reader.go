@@ -0,0 +1,106 @@
+package sak
+
+import (
+	"github.com/metachord/flv.go/flv"
+	"io"
+	"os"
+)
+
+// Reader reads frames of FLV file and keeps location of the last read tag
+// for error reports.
+type Reader struct {
+	*flv.FlvReader
+	Header *flv.Header
+
+	last  Location
+	start int64 // offset of the first tag
+	next  int64 // offset of the next tag
+	index int   // index of the next tag, -1 if unknown
+}
+
+// OpenReader opens FLV file and reads its header.
+func OpenReader(name string) (r *Reader, err error) {
+	inF, err := os.Open(name)
+	if err != nil {
+		return nil, &InputError{fileLocation(name), err}
+	}
+	r, err = NewReader(inF)
+	if err != nil {
+		inF.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewReader reads FLV header from inF.
+func NewReader(inF *os.File) (r *Reader, err error) {
+	r = &Reader{FlvReader: flv.NewReader(inF)}
+	r.last = fileLocation(inF.Name())
+	r.Header, err = r.ReadHeader()
+	if err != nil {
+		return nil, &InputError{Location{inF.Name(), 0, -1, 0}, err}
+	}
+	r.start, err = inF.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, &InputError{r.last, err}
+	}
+	r.next = r.start
+	return r, nil
+}
+
+// Name returns name of input file.
+func (r *Reader) Name() string {
+	return r.InFile.Name()
+}
+
+// Close closes input file.
+func (r *Reader) Close() error {
+	return r.InFile.Close()
+}
+
+// Location returns location of the last read tag.
+func (r *Reader) Location() Location {
+	return r.last
+}
+
+// nextLocation returns location of the tag to be read next.
+func (r *Reader) nextLocation() Location {
+	return Location{File: r.Name(), Offset: r.next, Index: r.index, Dts: r.last.Dts}
+}
+
+// SeekTag moves reader to tag at offset. Indexes of tags are unknown after
+// seek to other than the first tag.
+func (r *Reader) SeekTag(offset int64) (err error) {
+	_, err = r.InFile.Seek(offset, io.SeekStart)
+	if err != nil {
+		return &InputError{r.last, err}
+	}
+	r.next = offset
+	r.index = -1
+	if offset == r.start {
+		r.index = 0
+	}
+	return nil
+}
+
+// Rewind moves reader to the first tag.
+func (r *Reader) Rewind() error {
+	return r.SeekTag(r.start)
+}
+
+// advance updates location after frame is read.
+func (r *Reader) advance(frame flv.Frame) {
+	r.last = r.nextLocation()
+	r.last.Dts = frame.GetDts()
+	r.next += int64(flv.TAG_HEADER_LENGTH + len(*frame.GetBody()) + flv.PREV_TAG_SIZE_LENGTH)
+	if r.index >= 0 {
+		r.index++
+	}
+}
+
+// resync updates offset of the next tag after recovery skipped data.
+func (r *Reader) resync() {
+	if off, err := r.InFile.Seek(0, io.SeekCurrent); err == nil {
+		r.next = off
+	}
+}
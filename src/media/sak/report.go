@@ -0,0 +1,258 @@
+package sak
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/metachord/amf.go/amf0"
+	"github.com/metachord/flv.go/flv"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Report describes FLV file: its header, tags of every stream, script tags
+// and claims of onMetaData which differ from the file.
+type Report struct {
+	File    string         `json:"file"`
+	Header  HeaderReport   `json:"header"`
+	Streams []StreamReport `json:"streams"`
+	// Events counts script tags by event name.
+	Events     map[string]int `json:"events"`
+	Mismatches []Mismatch     `json:"mismatches"`
+}
+
+// HeaderReport is FLV header as it is in the file.
+type HeaderReport struct {
+	Version    int    `json:"version"`
+	Audio      bool   `json:"audio"`
+	Video      bool   `json:"video"`
+	DataOffset uint32 `json:"data_offset"`
+}
+
+// StreamReport holds statistics of tags of one stream of tag type.
+type StreamReport struct {
+	// Type is video, audio or meta.
+	Type     string `json:"type"`
+	Stream   uint32 `json:"stream"`
+	Tags     int    `json:"tags"`
+	FirstDts uint32 `json:"first_dts"`
+	LastDts  uint32 `json:"last_dts"`
+	// Bytes is total size of tag bodies.
+	Bytes uint64 `json:"bytes"`
+	// Codec is codec id or FourCC with readable name of the first audio or
+	// video tag, e.g. "7 (AVC)".
+	Codec string `json:"codec,omitempty"`
+}
+
+// Mismatch is onMetaData value which differs from the one found by scan.
+type Mismatch struct {
+	Key  string      `json:"key"`
+	Meta interface{} `json:"meta"`
+	File interface{} `json:"file"`
+}
+
+func tagTypeName(t flv.TagType) string {
+	switch t {
+	case flv.TAG_TYPE_VIDEO:
+		return "video"
+	case flv.TAG_TYPE_AUDIO:
+		return "audio"
+	case flv.TAG_TYPE_META:
+		return "meta"
+	}
+	return fmt.Sprintf("type%d", t)
+}
+
+// Report scans inFile and returns its report.
+func (j *Job) Report(inFile string) (rep *Report, err error) {
+	rep, _, err = j.scanReport(inFile)
+	return rep, err
+}
+
+// scanReport returns report of inFile and onMetaData regenerated for the
+// file as it is.
+func (j *Job) scanReport(inFile string) (rep *Report, meta amf0.EcmaArrayType, err error) {
+	j.reset()
+	defer j.end(&err)
+
+	r, err := OpenReader(inFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	j.header = r.Header
+
+	rep = &Report{File: inFile, Mismatches: []Mismatch{}}
+	var h [9]byte
+	if _, err = r.InFile.ReadAt(h[:], 0); err != nil {
+		return nil, nil, &InputError{Location{inFile, 0, -1, 0}, err}
+	}
+	rep.Header = HeaderReport{
+		Version:    int(h[3]),
+		Audio:      h[4]&0x04 != 0,
+		Video:      h[4]&0x01 != 0,
+		DataOffset: binary.BigEndian.Uint32(h[5:9]),
+	}
+
+	// the file as it is: sizes of onMetaData in place
+	j.inPlace = true
+	scanned, stats, err := j.createMeta(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, st := range stats.streams {
+		rep.Streams = append(rep.Streams, *st)
+	}
+	order := map[string]int{"video": 0, "audio": 1, "meta": 2}
+	sort.Slice(rep.Streams, func(a, b int) bool {
+		sa, sb := rep.Streams[a], rep.Streams[b]
+		if sa.Type != sb.Type {
+			return order[sa.Type] < order[sb.Type]
+		}
+		return sa.Stream < sb.Stream
+	})
+	rep.Events = stats.events
+	if stats.oldMeta != nil {
+		rep.Mismatches = append(rep.Mismatches, compareMeta(stats.oldMeta, *scanned, stats)...)
+	}
+	return rep, *scanned, nil
+}
+
+// compareMeta returns values of stored onMetaData which differ from scanned
+// ones. Keys flvsak does not compute are not compared, keyframes and
+// cuePoints are compared by number of entries, datasize, videosize and
+// audiosize match by any definition of scanStats.dataSizes and typeSizes,
+// as -verify-index checks them.
+func compareMeta(stored map[amf0.StringType]interface{}, scanned amf0.EcmaArrayType, stats *scanStats) (ms []Mismatch) {
+	sizes := map[string][]float64{
+		"datasize":  stats.dataSizes(),
+		"videosize": stats.typeSizes("video"),
+		"audiosize": stats.typeSizes("audio"),
+	}
+	keys := make([]string, 0, len(scanned))
+	for k := range scanned {
+		keys = append(keys, string(k))
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		old, ok := stored[amf0.StringType(k)]
+		if !ok || k == "metadatacreator" || k == "metadatadate" {
+			continue
+		}
+		got, want := plainValue(old), plainValue(scanned[amf0.StringType(k)])
+		switch k {
+		case "keyframes":
+			if stored["hasKeyframes"] == amf0.BooleanType(false) {
+				// audio index depends on interval
+				continue
+			}
+			got, want = indexLength(old), indexLength(scanned[amf0.StringType(k)])
+			k = "keyframes.filepositions length"
+		case "cuePoints":
+			got, want = arrayLength(old), arrayLength(scanned[amf0.StringType(k)])
+			k = "cuePoints length"
+		case "datasize", "videosize", "audiosize":
+			if g, ok := got.(float64); ok && containsSize(sizes[k], g) {
+				continue
+			}
+		}
+		if !metaValuesMatch(k, got, want) {
+			ms = append(ms, Mismatch{Key: k, Meta: got, File: want})
+		}
+	}
+	return ms
+}
+
+// indexLength returns number of keyframes filepositions, nil for broken
+// index.
+func indexLength(kfs interface{}) interface{} {
+	_, positions, err := keyframesIndex(map[amf0.StringType]interface{}{"keyframes": kfs})
+	if err != nil {
+		return nil
+	}
+	return float64(len(positions))
+}
+
+// arrayLength returns length of strict array, nil for other values.
+func arrayLength(v interface{}) interface{} {
+	if a, ok := v.(*amf0.StrictArrayType); ok {
+		return float64(len(*a))
+	}
+	return nil
+}
+
+// metaValuesMatch compares plain values of key. Timestamps match within
+// maxDurationDiff and rates within 1%, as tools compute them differently.
+func metaValuesMatch(key string, got, want interface{}) bool {
+	g, gok := got.(float64)
+	w, wok := want.(float64)
+	if !gok || !wok {
+		return reflect.DeepEqual(got, want)
+	}
+	switch {
+	case key == "duration" || key == "lasttimestamp" || key == "lastkeyframetimestamp":
+		return math.Abs(g-w) <= maxDurationDiff
+	case key == "framerate" || strings.HasSuffix(key, "datarate"):
+		return math.Abs(g-w) <= 0.01*math.Abs(w)
+	}
+	return g == w
+}
+
+// PrintReport prints report in text, JSON or YAML format of options.
+func (j *Job) PrintReport(rep *Report, w io.Writer) error {
+	switch j.opts.Format {
+	case "", FormatText:
+		printReportText(rep, w)
+		return nil
+	case FormatJSON:
+		if err := writeJSON(w, rep); err != nil {
+			return &OutputError{fileLocation(rep.File), "", err}
+		}
+		return nil
+	case FormatYAML:
+		v, err := plainReport(rep)
+		if err != nil {
+			return &OutputError{fileLocation(rep.File), "", err}
+		}
+		writeYAML(w, v, "")
+		return nil
+	}
+	return optionsErrorf("format %s is not supported for report", j.opts.Format)
+}
+
+// plainReport converts report to plain map with keys of its JSON encoding.
+func plainReport(rep *Report) (v map[string]interface{}, err error) {
+	data, err := json.Marshal(rep)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &v)
+	return v, err
+}
+
+func printReportText(rep *Report, w io.Writer) {
+	h := rep.Header
+	fmt.Fprintf(w, "file: %s\n", rep.File)
+	fmt.Fprintf(w, "header: version %d, audio %t, video %t, data offset %d\n", h.Version, h.Audio, h.Video, h.DataOffset)
+	for _, st := range rep.Streams {
+		fmt.Fprintf(w, "%s stream %d: %d tags, dts %d..%d, %d bytes", st.Type, st.Stream, st.Tags, st.FirstDts, st.LastDts, st.Bytes)
+		if st.Codec != "" {
+			fmt.Fprintf(w, ", codec %s", st.Codec)
+		}
+		fmt.Fprintln(w)
+	}
+	events := make([]string, 0, len(rep.Events))
+	for name := range rep.Events {
+		events = append(events, name)
+	}
+	sort.Strings(events)
+	for _, name := range events {
+		fmt.Fprintf(w, "event %s: %d tags\n", name, rep.Events[name])
+	}
+	for _, m := range rep.Mismatches {
+		fmt.Fprintf(w, "mismatch %s: onMetaData %v, file %v\n", m.Key, m.Meta, m.File)
+	}
+}
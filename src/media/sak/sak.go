@@ -0,0 +1,213 @@
+// Package sak implements the operations of the flvsak tool: metadata and
+// keyframes regeneration, cropping, splitting and concatenation of FLV files.
+//
+// All state of an operation lives in a Job, so independent jobs may run
+// concurrently in one process. A single Job must not be used concurrently.
+package sak
+
+import (
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// Options controls behaviour of a Job.
+type Options struct {
+	// Recover skips broken data instead of failing on read errors.
+	Recover bool
+	// KeepPartial keeps outputs of failed operation instead of removing them.
+	KeepPartial bool
+	// MaxScanSize is the max interval to look for valid frame during recovery.
+	MaxScanSize int
+
+	Verbose bool
+	// Logger receives progress messages, nil discards them.
+	Logger *log.Logger
+
+	// Streams maps tag type to the only stream id to keep,
+	// missing type or -1 keeps all streams.
+	Streams map[flv.TagType]int
+	// CompensateDts shifts dts of kept frames by duration of removed streams.
+	CompensateDts bool
+
+	// Crop lists inclusive ranges of dts to cut out.
+	Crop [][2]int
+	// CropWaitKeyframe moves crop bounds to the nearest video keyframe.
+	CropWaitKeyframe bool
+
+	// SkipMeta drops onMetaData tags having any of listed values for a key.
+	SkipMeta map[string][]string
+
+	// FixDts fixes non monotonically increasing dts.
+	FixDts bool
+	// ScaleDts multiplies every dts, zero means 1.0.
+	ScaleDts float64
+
+	// SplitStreams writes every non-zero stream to its own file.
+	SplitStreams bool
+	// SplitStreamsStopAfter closes stream file after this many milliseconds without frames.
+	SplitStreamsStopAfter int
+	// SplitStreamsMinimalDuration removes stream files shorter than this many milliseconds.
+	SplitStreamsMinimalDuration int
+
+	// CuePoints are inserted as onCuePoint tags by cue-points stage and
+	// listed in onMetaData.
+	CuePoints []CuePoint
+	// MergeMeta keeps keys of original onMetaData which are not computed,
+	// only listed in MergeMetaKeys if it is not empty and except listed in
+	// DropMetaKeys.
+	MergeMeta     bool
+	MergeMetaKeys []string
+	DropMetaKeys  []string
+	// MetaPadding reserves this many bytes of padding keys in new onMetaData
+	// so later updates fit in place.
+	MetaPadding int
+	// SeekInterval is interval in milliseconds between points of keyframes
+	// index built from audio tags of files without video keyframes, zero
+	// means 1000.
+	SeekInterval int
+	// MetaSet sets keys of new onMetaData to AMF0 values, MetaDelete
+	// removes keys from it.
+	MetaSet    map[string]interface{}
+	MetaDelete []string
+	// Pipeline lists names of stages frames pass through in order, empty
+	// means DefaultPipeline. Stages not listed are not applied.
+	Pipeline []string
+	// Stages maps names of custom stages usable in Pipeline to their
+	// constructors, called once for every input file.
+	Stages map[string]func() FrameFilter
+
+	// Format is output format of Info: FormatText, the default,
+	// FormatJSON, FormatYAML or FormatXML; of Inventory: FormatText,
+	// FormatCSV or FormatJSONL; of Dump: FormatText, FormatCSV,
+	// FormatJSONL or FormatFrameHash.
+	Format string
+	// Workers is number of files Inventory scans at once, zero means number
+	// of CPUs.
+	Workers int
+
+	// MinDts and MaxDts bound dumped frames (inclusive), -1 disables the bound.
+	MinDts, MaxDts int
+	// Dump selects dumped frames besides MinDts and MaxDts.
+	Dump DumpFilter
+	// DumpPayload is number of bytes of tag body Dump and Find print in
+	// hex along with NAL units of AVC and HEVC frames, size of AAC frames
+	// and AMF values of script tags, 0 disables payload.
+	DumpPayload int
+	// FrameHash is HashMD5, the default, or HashSHA256 checksum of tag
+	// bodies of FormatFrameHash. FrameHashNoTimestamps leaves dts out, so
+	// checksums of retimed file match the original ones.
+	FrameHash             string
+	FrameHashNoTimestamps bool
+}
+
+// DefaultOptions returns options matching defaults of the flvsak command.
+func DefaultOptions() Options {
+	return Options{
+		ScaleDts:                    1.0,
+		SplitStreamsStopAfter:       5000,
+		SplitStreamsMinimalDuration: 5000,
+		MinDts:                      -1,
+		MaxDts:                      -1,
+		Dump:                        DumpFilter{MinOffset: -1, MaxOffset: -1, MinIndex: -1, MaxIndex: -1, StopPastMaxDts: -1},
+	}
+}
+
+// Job holds options and state of flvsak operations.
+type Job struct {
+	opts Options
+	log  *log.Logger
+
+	header  *flv.Header
+	outputs []*os.File
+
+	streamsWriters  map[uint32]*streamWriter
+	splitFileNumber int
+	// splitBaseDts is output dts of the last frame of stream 0, stream
+	// files of split-streams are named and closed by it.
+	splitBaseDts int
+
+	// inPlace is set by UpdateInPlace: keyframes positions are computed for
+	// onMetaData rewritten in place of the old one.
+	inPlace bool
+	// replacedMeta is position of input onMetaData tag which WriteFrames
+	// skips as new one is already written, -1 for none.
+	replacedMeta int64
+}
+
+// NewJob creates a job with given options.
+func NewJob(opts Options) *Job {
+	if opts.ScaleDts == 0 {
+		opts.ScaleDts = 1.0
+	}
+	if opts.SeekInterval == 0 {
+		opts.SeekInterval = 1000
+	}
+	j := &Job{opts: opts, log: opts.Logger, replacedMeta: -1}
+	if j.log == nil {
+		j.log = log.New(ioutil.Discard, "", 0)
+	}
+	return j
+}
+
+// reset clears state left from previous operation of the job.
+func (j *Job) reset() {
+	j.header = nil
+	j.outputs = nil
+	j.streamsWriters = nil
+	j.splitFileNumber = 0
+	j.splitBaseDts = 0
+	j.inPlace = false
+	j.replacedMeta = -1
+}
+
+func (j *Job) logf(format string, v ...interface{}) {
+	j.log.Printf(format, v...)
+}
+
+type kfTimePos struct {
+	Dts      uint32
+	Position int64
+	// Inserted is size of tags inserted before keyframe in output.
+	Inserted int64
+}
+
+// readFrame returns next frame or nil at the end of input. Broken data is
+// skipped when recovery is enabled.
+func (j *Job) readFrame(r *Reader) (frame flv.Frame, err error) {
+	for {
+		frame, rerr := r.ReadFrame()
+		switch {
+		case rerr != nil && !j.opts.Recover:
+			return nil, &InputError{r.nextLocation(), rerr}
+		case rerr != nil && rerr.IsRecoverable():
+			_, err, skipBytes := r.Recover(rerr, j.opts.MaxScanSize)
+			if err != nil {
+				return nil, &InputError{r.nextLocation(), fmt.Errorf("recovery error: %s", err)}
+			}
+			j.logf("recover: got fine frame after %d bytes", skipBytes)
+			r.resync()
+			continue
+		}
+		if frame != nil {
+			r.advance(frame)
+		}
+		return frame, nil
+	}
+}
+
+// writeFrame writes frame read from r to w.
+func (j *Job) writeFrame(r *Reader, w *flv.FlvWriter, frame flv.Frame) error {
+	if err := w.WriteFrame(frame); err != nil {
+		return &OutputError{r.Location(), w.OutFile.Name(), err}
+	}
+	return nil
+}
+
+// isKeyFrame reports whether frame is video keyframe, legacy or Enhanced RTMP.
+func isKeyFrame(frame flv.Frame) bool {
+	t := videoTag(frame)
+	return t != nil && t.IsKeyFrame()
+}
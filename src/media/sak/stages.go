@@ -0,0 +1,333 @@
+package sak
+
+import (
+	"bytes"
+	"github.com/metachord/amf.go/amf0"
+	"github.com/metachord/flv.go/flv"
+)
+
+// Names of built-in pipeline stages.
+const (
+	StageTracks       = "tracks"
+	StageSplitStreams = "split-streams"
+	StageStreams      = "streams"
+	StageCrop         = "crop"
+	StageSkipMeta     = "skip-meta"
+	StageFixDts       = "fix-dts"
+	StageScaleDts     = "scale-dts"
+	StageCuePoints    = "cue-points"
+)
+
+// DefaultPipeline returns stages order used when Options.Pipeline is empty.
+// Crop comes first to see frames of all streams, as keyframes of streams
+// dropped later move its bounds too.
+func DefaultPipeline() []string {
+	return []string{StageCrop, StageTracks, StageSplitStreams, StageStreams, StageSkipMeta, StageFixDts, StageScaleDts, StageCuePoints}
+}
+
+// newPipeline builds stages listed in options. Stages keep state of one
+// input, so new pipeline is built for every input file, offset is the
+// output dts the input starts from. Pipeline starts and ends with stages
+// of dtsCompensator shared by stages dropping frames, dts are shifted by
+// offset before compensation.
+func (j *Job) newPipeline(offset int) (p *Pipeline, err error) {
+	names := j.opts.Pipeline
+	if len(names) == 0 {
+		names = DefaultPipeline()
+	}
+	comp := &dtsCompensator{compensate: j.opts.CompensateDts}
+	p = NewPipeline(FilterFunc(comp.input))
+	for _, name := range names {
+		switch name {
+		case StageTracks:
+			if types := j.trackTypes(); len(types) > 0 {
+				p.Add(&tracksFilter{types: types})
+			}
+		case StageSplitStreams:
+			if j.opts.SplitStreams {
+				p.Add(&splitStreamsFilter{job: j, comp: comp})
+			}
+		case StageStreams:
+			p.Add(&streamsFilter{streams: j.opts.Streams, comp: comp})
+		case StageCrop:
+			if len(j.opts.Crop) > 0 {
+				p.Add(&cropFilter{crop: j.opts.Crop, waitKeyframe: j.opts.CropWaitKeyframe, comp: comp})
+			}
+		case StageSkipMeta:
+			if len(j.opts.SkipMeta) > 0 {
+				p.Add(&skipMetaFilter{skip: j.opts.SkipMeta, comp: comp})
+			}
+		case StageFixDts:
+			p.Add(newFixDtsFilter(j))
+		case StageScaleDts:
+			if j.opts.ScaleDts != 1.0 {
+				p.Add(&scaleDtsFilter{scale: j.opts.ScaleDts})
+			}
+		case StageCuePoints:
+			if len(j.opts.CuePoints) > 0 {
+				p.Add(&cuePointsFilter{cues: sortCuePoints(j.opts.CuePoints)})
+			}
+		default:
+			mk, ok := j.opts.Stages[name]
+			if !ok {
+				return nil, optionsErrorf("unknown pipeline stage: %s", name)
+			}
+			p.Add(mk())
+		}
+	}
+	if offset != 0 {
+		p.Add(&offsetDtsFilter{offset: offset})
+	}
+	p.Add(FilterFunc(comp.output))
+	return p, nil
+}
+
+// trackTypes returns tag types which multitrack tags are split into tracks
+// for: types with selected stream or all with split-streams.
+func (j *Job) trackTypes() map[flv.TagType]bool {
+	types := make(map[flv.TagType]bool)
+	for _, t := range []flv.TagType{flv.TAG_TYPE_VIDEO, flv.TAG_TYPE_AUDIO} {
+		if id, ok := j.opts.Streams[t]; (ok && id != -1) || j.opts.SplitStreams {
+			types[t] = true
+		}
+	}
+	return types
+}
+
+// dtsCompensator shifts dts of written frames back by total duration of
+// dropped input frames. Duration of input frame is its input dts difference
+// to the previous one, it is compensated when no frame of it reached the
+// end of pipeline and any stage dropped it: crop always, other stages only
+// with compensate. Compensation is subtracted from dts coming out of all
+// other stages, fix-dts, scale-dts and offset included.
+type dtsCompensator struct {
+	compensate   bool
+	lastInTs     uint32
+	inDelta      uint32
+	dropped      bool
+	passed       bool
+	compensateTs uint32
+}
+
+// input is the first stage of pipeline, it compensates the previous input
+// frame if it was dropped.
+func (c *dtsCompensator) input(frame flv.Frame) ([]flv.Frame, error) {
+	if c.dropped && !c.passed {
+		c.compensateTs += c.inDelta
+	}
+	c.inDelta = 0
+	if frame.GetDts() > c.lastInTs {
+		c.inDelta = frame.GetDts() - c.lastInTs
+	}
+	c.lastInTs = frame.GetDts()
+	c.dropped, c.passed = false, false
+	return []flv.Frame{frame}, nil
+}
+
+// drop records frame dropped by stage, crop is set by crop stage.
+func (c *dtsCompensator) drop(crop bool) {
+	if c.compensate || crop {
+		c.dropped = true
+	}
+}
+
+// output is the last stage of pipeline.
+func (c *dtsCompensator) output(frame flv.Frame) ([]flv.Frame, error) {
+	c.passed = true
+	frame.SetDts(frame.GetDts() - c.compensateTs)
+	return []flv.Frame{frame}, nil
+}
+
+// streamsFilter keeps only selected stream of every tag type.
+type streamsFilter struct {
+	streams map[flv.TagType]int
+	comp    *dtsCompensator
+}
+
+func (f *streamsFilter) Filter(frame flv.Frame) ([]flv.Frame, error) {
+	id, ok := f.streams[frame.GetType()]
+	if !ok || id == -1 || frame.GetStream() == uint32(id) {
+		return []flv.Frame{frame}, nil
+	}
+	f.comp.drop(false)
+	return nil, nil
+}
+
+// cropFilter cuts frames in ranges of dts and closes the gaps.
+type cropFilter struct {
+	crop         [][2]int
+	waitKeyframe bool
+	cropIdx      int
+	cropActive   bool
+	comp         *dtsCompensator
+}
+
+func (f *cropFilter) Filter(frame flv.Frame) ([]flv.Frame, error) {
+	if f.permitCrop(frame) {
+		f.comp.drop(true)
+		return nil, nil
+	}
+	return []flv.Frame{frame}, nil
+}
+
+func (f *cropFilter) permitCrop(frame flv.Frame) (isCrop bool) {
+	isCrop = false
+	if len(f.crop) <= f.cropIdx {
+		return
+	}
+	start, stop := uint32(f.crop[f.cropIdx][0]), uint32(f.crop[f.cropIdx][1])
+	if start <= frame.GetDts() && frame.GetDts() <= stop {
+		if f.waitKeyframe && !f.cropActive {
+			if isKeyFrame(frame) {
+				f.cropActive = true
+				isCrop = true
+			}
+		} else {
+			f.cropActive = true
+			isCrop = true
+		}
+	} else {
+		if f.waitKeyframe && f.cropActive {
+			if isKeyFrame(frame) {
+				isCrop = false
+				f.cropIdx++
+				f.cropActive = false
+			}
+		} else {
+			if f.cropActive {
+				f.cropIdx++
+				f.cropActive = false
+			}
+			isCrop = false
+		}
+	}
+	return
+}
+
+// skipMetaFilter drops onMetaData tags having listed values.
+type skipMetaFilter struct {
+	skip map[string][]string
+	comp *dtsCompensator
+}
+
+func (f *skipMetaFilter) Filter(frame flv.Frame) ([]flv.Frame, error) {
+	if f.permitSkip(frame) {
+		f.comp.drop(false)
+		return nil, nil
+	}
+	return []flv.Frame{frame}, nil
+}
+
+func (f *skipMetaFilter) permitSkip(frame flv.Frame) (isSkip bool) {
+	if frame.GetType() == flv.TAG_TYPE_META {
+		metaBody := frame.GetBody()
+		buf := bytes.NewReader(*metaBody)
+		dec := amf0.NewDecoder(buf)
+		evName, err := dec.Decode()
+		if err == nil {
+			switch evName {
+			case amf0.StringType("onMetaData"):
+				md, err := dec.Decode()
+				if err == nil {
+					var ea map[amf0.StringType]interface{}
+					switch md := md.(type) {
+					case *amf0.EcmaArrayType:
+						ea = *md
+					case *amf0.ObjectType:
+						ea = *md
+					}
+					for skipK, skipV := range f.skip {
+						if s, ok := ea[amf0.StringType(skipK)]; ok {
+							for _, t := range skipV {
+								if amf0.StringType(t) == s {
+									return true
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// fixDtsFilter warns about non monotonically increasing dts of every
+// stream and, if enabled, continues such stream with its last dts delta.
+type fixDtsFilter struct {
+	job        *Job
+	lastTs     map[flv.TagType]map[uint32]uint32
+	lastTsDiff map[flv.TagType]map[uint32]uint32
+	shiftTs    map[flv.TagType]map[uint32]uint32
+}
+
+func newFixDtsFilter(j *Job) *fixDtsFilter {
+	f := &fixDtsFilter{
+		job:        j,
+		lastTs:     make(map[flv.TagType]map[uint32]uint32),
+		lastTsDiff: make(map[flv.TagType]map[uint32]uint32),
+		shiftTs:    make(map[flv.TagType]map[uint32]uint32),
+	}
+	for _, c := range []flv.TagType{flv.TAG_TYPE_VIDEO, flv.TAG_TYPE_AUDIO, flv.TAG_TYPE_META} {
+		f.lastTs[c] = make(map[uint32]uint32)
+		f.lastTsDiff[c] = make(map[uint32]uint32)
+		f.shiftTs[c] = make(map[uint32]uint32)
+	}
+	return f
+}
+
+func (f *fixDtsFilter) Filter(frame flv.Frame) ([]flv.Frame, error) {
+	c := frame.GetType()
+	s := frame.GetStream()
+	d := frame.GetDts()
+	if f.lastTs[c][s] > d {
+		f.job.warnTs(f.lastTs[c][s], s, d)
+		if f.job.opts.FixDts {
+			newDts := f.lastTs[c][s] + f.lastTsDiff[c][s]
+			f.shiftTs[c][s] = newDts - d
+			d += f.shiftTs[c][s]
+		}
+	}
+	f.lastTsDiff[c][s] = d - f.lastTs[c][s]
+	f.lastTs[c][s] = d
+	frame.SetDts(d)
+	return []flv.Frame{frame}, nil
+}
+
+// scaleDtsFilter multiplies dts by constant.
+type scaleDtsFilter struct {
+	scale float64
+}
+
+func (f *scaleDtsFilter) Filter(frame flv.Frame) ([]flv.Frame, error) {
+	frame.SetDts(uint32(float64(frame.GetDts()) * f.scale))
+	return []flv.Frame{frame}, nil
+}
+
+// offsetDtsFilter shifts dts by constant, used to continue timeline of
+// concatenated files.
+type offsetDtsFilter struct {
+	offset int
+}
+
+func (f *offsetDtsFilter) Filter(frame flv.Frame) ([]flv.Frame, error) {
+	frame.SetDts(uint32(int(frame.GetDts()) + f.offset))
+	return []flv.Frame{frame}, nil
+}
+
+// splitStreamsFilter moves frames of non-zero streams to their own files.
+// Stream files are owned by job and stay open between input files, they
+// start from output dts of stream 0.
+type splitStreamsFilter struct {
+	job  *Job
+	comp *dtsCompensator
+}
+
+func (f *splitStreamsFilter) Filter(frame flv.Frame) ([]flv.Frame, error) {
+	if frame.GetStream() != 0 && frame.GetType() != flv.TAG_TYPE_META {
+		f.comp.drop(false)
+		return nil, f.job.writeStreamFrame(frame, f.job.splitBaseDts)
+	}
+	f.job.checkSplitWriters(f.job.splitBaseDts)
+	return []flv.Frame{frame}, nil
+}
@@ -0,0 +1,53 @@
+package sak
+
+import (
+	"github.com/metachord/flv.go/flv"
+	"reflect"
+	"testing"
+)
+
+func testVideoFrame(stream, dts uint32, key bool) flv.Frame {
+	body := []byte{0x27, 0x01, 0, 0, 0}
+	flavor := flv.FRAME
+	if key {
+		body[0] = 0x17
+		flavor = flv.KEYFRAME
+	}
+	return flv.VideoFrame{CFrame: &flv.CFrame{Stream: stream, Dts: dts, Type: flv.TAG_TYPE_VIDEO, Flavor: flavor, Body: body}}
+}
+
+func TestCropSeesDroppedStreams(t *testing.T) {
+	j := NewJob(Options{
+		Streams:          map[flv.TagType]int{flv.TAG_TYPE_VIDEO: 0},
+		Crop:             [][2]int{{1000, 2000}},
+		CropWaitKeyframe: true,
+	})
+	p, err := j.newPipeline(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keyframe of stream 1 starts the crop, the range is cut out of stream 0
+	// though it has no keyframe inside, frames past the range are kept
+	in := []flv.Frame{
+		testVideoFrame(0, 0, true),
+		testVideoFrame(1, 1000, true),
+		testVideoFrame(0, 1000, false),
+		testVideoFrame(0, 1500, false),
+		testVideoFrame(0, 2500, false),
+		testVideoFrame(1, 2500, true),
+		testVideoFrame(0, 3000, true),
+	}
+	var got []uint32
+	for _, frame := range in {
+		out, err := p.Filter(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, o := range out {
+			got = append(got, o.GetDts())
+		}
+	}
+	if want := []uint32{0, 1000, 1500}; !reflect.DeepEqual(got, want) {
+		t.Errorf("output dts %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,115 @@
+package sak
+
+import (
+	"github.com/metachord/flv.go/flv"
+	"sort"
+)
+
+// streamKey identifies stream of tag type.
+type streamKey struct {
+	Type   flv.TagType
+	Stream uint32
+}
+
+// timeline collects dts of one stream to find typical frame duration.
+type timeline struct {
+	last   uint32
+	frames int
+	deltas []uint32
+}
+
+func (t *timeline) add(dts uint32) {
+	if t.frames > 0 && dts > t.last {
+		t.deltas = append(t.deltas, dts-t.last)
+	}
+	t.frames++
+	t.last = dts
+}
+
+// frameDuration returns typical dts delta in milliseconds: mean of deltas
+// close to the median, so gaps and jitter of rounded dts do not count. It
+// is 0 for streams of less than two distinct dts.
+func (t *timeline) frameDuration() float64 {
+	if len(t.deltas) == 0 {
+		return 0
+	}
+	sorted := make([]uint32, len(t.deltas))
+	copy(sorted, t.deltas)
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+	median := sorted[len(sorted)/2]
+	var sum, n uint64
+	for _, d := range sorted {
+		if 2*d >= median && 2*d <= 3*median {
+			sum += uint64(d)
+			n++
+		}
+	}
+	return float64(sum) / float64(n)
+}
+
+// end returns end time of the last frame in milliseconds.
+func (t *timeline) end() float64 {
+	return float64(t.last) + t.frameDuration()
+}
+
+// bitrateMeter measures bitrate of data in one second intervals.
+type bitrateMeter struct {
+	seconds map[uint32]uint64 // bytes by second of dts
+	window  []bitrateSample   // samples of the last second
+	sum     uint64            // bytes in window
+	peak    uint64            // max bytes in any one second window
+}
+
+type bitrateSample struct {
+	dts  uint32
+	size uint64
+}
+
+func newBitrateMeter() *bitrateMeter {
+	return &bitrateMeter{seconds: make(map[uint32]uint64)}
+}
+
+func (m *bitrateMeter) add(dts uint32, size int) {
+	m.seconds[dts/1000] += uint64(size)
+	m.window = append(m.window, bitrateSample{dts, uint64(size)})
+	m.sum += uint64(size)
+	for len(m.window) > 0 && m.window[0].dts+1000 <= dts {
+		m.sum -= m.window[0].size
+		m.window = m.window[1:]
+	}
+	if m.sum > m.peak {
+		m.peak = m.sum
+	}
+}
+
+// rates returns minimal and maximal bitrate of whole seconds and peak
+// bitrate of any one second window, all in kbit/s. The last, incomplete,
+// second counts only when there is no other.
+func (m *bitrateMeter) rates() (min, max, peak float64) {
+	if len(m.seconds) == 0 {
+		return 0, 0, 0
+	}
+	first, last := ^uint32(0), uint32(0)
+	for s := range m.seconds {
+		if s < first {
+			first = s
+		}
+		if s > last {
+			last = s
+		}
+	}
+	if last > first {
+		last--
+	}
+	min = -1
+	for s := first; s <= last; s++ {
+		rate := float64(m.seconds[s]) * 8 / 1000
+		if min < 0 || rate < min {
+			min = rate
+		}
+		if rate > max {
+			max = rate
+		}
+	}
+	return min, max, float64(m.peak) * 8 / 1000
+}
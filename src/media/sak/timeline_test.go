@@ -0,0 +1,69 @@
+package sak
+
+import (
+	"math"
+	"testing"
+)
+
+func testTimeline(dts ...uint32) *timeline {
+	t := &timeline{}
+	for _, d := range dts {
+		t.add(d)
+	}
+	return t
+}
+
+func TestFrameDurationRounded(t *testing.T) {
+	// 29.97 fps with dts rounded to milliseconds: deltas of 33 and 34
+	for _, fps := range []float64{23.976, 29.97, 59.94, 25} {
+		tl := &timeline{}
+		for i := 0; i < 300; i++ {
+			tl.add(uint32(math.Round(float64(i) * 1000 / fps)))
+		}
+		if got := 1000 / tl.frameDuration(); math.Abs(got-fps) > 0.01 {
+			t.Errorf("frame rate %v, want %v", got, fps)
+		}
+	}
+}
+
+func TestFrameDurationGaps(t *testing.T) {
+	// gap, repeated and backward dts do not count
+	tl := testTimeline(0, 40, 80, 120, 2120, 2160, 2160, 2200, 1000, 1040, 1080, 1120)
+	if got := tl.frameDuration(); got != 40 {
+		t.Errorf("frame duration %v, want 40", got)
+	}
+	if got := tl.end(); got != 1160 {
+		t.Errorf("end %v, want 1160", got)
+	}
+}
+
+func TestFrameDurationJitter(t *testing.T) {
+	// deltas within half and one and half of the median are averaged
+	tl := testTimeline(0, 30, 80, 120, 160, 300)
+	if got, want := tl.frameDuration(), (30.0+50+40+40)/4; got != want {
+		t.Errorf("frame duration %v, want %v", got, want)
+	}
+}
+
+func TestFrameDurationShort(t *testing.T) {
+	for _, tl := range []*timeline{testTimeline(), testTimeline(500), testTimeline(500, 500)} {
+		if got := tl.frameDuration(); got != 0 {
+			t.Errorf("frame duration %v of %d frames, want 0", got, tl.frames)
+		}
+	}
+	if got := testTimeline(500).end(); got != 500 {
+		t.Errorf("end of single frame %v, want 500", got)
+	}
+}
+
+func TestBitrateRates(t *testing.T) {
+	m := newBitrateMeter()
+	for _, s := range []bitrateSample{{0, 1000}, {500, 1000}, {1000, 500}, {1500, 500}, {1900, 1500}, {2000, 250}} {
+		m.add(s.dts, int(s.size))
+	}
+	// the last second is incomplete, peak window is 1000..1999
+	min, max, peak := m.rates()
+	if min != 16 || max != 20 || peak != 20 {
+		t.Errorf("rates %v, %v, %v, want 16, 20, 20", min, max, peak)
+	}
+}
@@ -0,0 +1,160 @@
+package sak
+
+import (
+	"errors"
+	"github.com/metachord/flv.go/flv"
+)
+
+// Track is one track of Enhanced RTMP multitrack tag.
+type Track struct {
+	ID     int
+	FourCC string
+	// Body is body of single-track Enhanced RTMP tag carrying the track.
+	Body []byte
+}
+
+// SplitTracks splits body of Enhanced RTMP multitrack audio or video tag
+// into bodies of single-track tags. Tracks is nil for other tags. ModEx
+// data of multitrack tag is not carried to tracks.
+func SplitTracks(tagType flv.TagType, body []byte) (tracks []Track, err error) {
+	if len(body) < 1 {
+		return nil, errShortData
+	}
+	var first byte
+	switch tagType {
+	case flv.TAG_TYPE_VIDEO:
+		if body[0]&0x80 == 0 {
+			return nil, nil
+		}
+		first = body[0] & 0xf0
+	case flv.TAG_TYPE_AUDIO:
+		if int(body[0]>>4) != audioFormatExHeader {
+			return nil, nil
+		}
+		first = body[0] & 0xf0
+	default:
+		return nil, nil
+	}
+	packetType, pos := int(body[0]&0x0f), 1
+	if packetType == VideoPacketModEx {
+		packetType, pos, err = skipModEx(body, pos)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if (tagType == flv.TAG_TYPE_VIDEO && packetType != VideoPacketMultitrack) ||
+		(tagType == flv.TAG_TYPE_AUDIO && packetType != AudioPacketMultitrack) {
+		return nil, nil
+	}
+
+	if len(body) < pos+1 {
+		return nil, errShortData
+	}
+	multitrackType := int(body[pos] >> 4)
+	first |= body[pos] & 0x0f
+	pos++
+	var fourcc string
+	if multitrackType != multitrackManyCodecs {
+		if len(body) < pos+4 {
+			return nil, errShortData
+		}
+		fourcc = string(body[pos : pos+4])
+		pos += 4
+	}
+	for pos < len(body) {
+		tr := Track{ID: int(body[pos]), FourCC: fourcc}
+		pos++
+		if multitrackType == multitrackManyCodecs {
+			if len(body) < pos+4 {
+				return nil, errShortData
+			}
+			tr.FourCC = string(body[pos : pos+4])
+			pos += 4
+		}
+		size := len(body) - pos
+		if multitrackType != multitrackOneTrack {
+			if len(body) < pos+3 {
+				return nil, errShortData
+			}
+			size = int(body[pos])<<16 | int(body[pos+1])<<8 | int(body[pos+2])
+			pos += 3
+		}
+		if len(body) < pos+size {
+			return nil, errShortData
+		}
+		tr.Body = make([]byte, 0, 5+size)
+		tr.Body = append(tr.Body, first)
+		tr.Body = append(tr.Body, tr.FourCC...)
+		tr.Body = append(tr.Body, body[pos:pos+size]...)
+		pos += size
+		tracks = append(tracks, tr)
+	}
+	if len(tracks) == 0 {
+		return nil, errors.New("multitrack tag without tracks")
+	}
+	return tracks, nil
+}
+
+// trackedFrame is single-track frame split from multitrack tag. It reports
+// track id as stream id, so stream selection and split-streams work on
+// tracks the same way as on legacy stream ids, while the tag itself keeps
+// stream id 0 and is written as plain FLV tag.
+type trackedFrame struct {
+	flv.Frame
+	track uint32
+}
+
+func (f *trackedFrame) GetStream() uint32 {
+	return f.track
+}
+
+// untrack returns frame as it is written to file: single-track frame
+// without its track id.
+func untrack(frame flv.Frame) flv.Frame {
+	if tf, ok := frame.(*trackedFrame); ok {
+		return tf.Frame
+	}
+	return frame
+}
+
+// trackFrame returns copy of audio or video frame of track with another
+// body and stream id 0.
+func trackFrame(frame flv.Frame, track uint32, body []byte) flv.Frame {
+	switch tfr := frame.(type) {
+	case flv.VideoFrame:
+		cf := *tfr.CFrame
+		cf.Stream, cf.Body = 0, body
+		tfr.CFrame = &cf
+		frame = tfr
+	case flv.AudioFrame:
+		cf := *tfr.CFrame
+		cf.Stream, cf.Body = 0, body
+		tfr.CFrame = &cf
+		frame = tfr
+	}
+	return &trackedFrame{Frame: frame, track: track}
+}
+
+// tracksFilter replaces multitrack tags of selected types with single-track
+// tags, one per track, see trackedFrame.
+type tracksFilter struct {
+	types map[flv.TagType]bool
+}
+
+func (f *tracksFilter) Filter(frame flv.Frame) ([]flv.Frame, error) {
+	if !f.types[frame.GetType()] {
+		return []flv.Frame{frame}, nil
+	}
+	tracks, err := SplitTracks(frame.GetType(), *frame.GetBody())
+	if err != nil {
+		return nil, err
+	}
+	if tracks == nil {
+		return []flv.Frame{frame}, nil
+	}
+	frames := make([]flv.Frame, len(tracks))
+	for i, tr := range tracks {
+		frames[i] = trackFrame(frame, uint32(tr.ID), tr.Body)
+	}
+	return frames, nil
+}
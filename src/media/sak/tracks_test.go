@@ -0,0 +1,113 @@
+package sak
+
+import (
+	"bytes"
+	"github.com/metachord/flv.go/flv"
+	"testing"
+)
+
+func TestSplitTracks(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		tagType flv.TagType
+		body    string
+		ids     []int
+		fourccs []string
+		bodies  []string
+	}{
+		{"many tracks", flv.TAG_TYPE_AUDIO, "95 11 4f707573 00 000002 aabb 01 000001 cc",
+			[]int{0, 1}, []string{"Opus", "Opus"}, []string{"91 4f707573 aabb", "91 4f707573 cc"}},
+		{"one track", flv.TAG_TYPE_VIDEO, "96 01 61763031 02 0a0b0c",
+			[]int{2}, []string{"av01"}, []string{"91 61763031 0a0b0c"}},
+		{"many codecs", flv.TAG_TYPE_VIDEO, "96 21 00 61766331 000001 01 01 68766331 000001 02",
+			[]int{0, 1}, []string{"avc1", "hvc1"}, []string{"91 61766331 01", "91 68766331 02"}},
+	} {
+		tracks, err := SplitTracks(c.tagType, hexBytes(c.body))
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		if len(tracks) != len(c.ids) {
+			t.Errorf("%s: %d tracks, want %d", c.name, len(tracks), len(c.ids))
+			continue
+		}
+		for i, tr := range tracks {
+			if tr.ID != c.ids[i] || tr.FourCC != c.fourccs[i] || !bytes.Equal(tr.Body, hexBytes(c.bodies[i])) {
+				t.Errorf("%s: track %d is %d %s % x, want %d %s %s", c.name, i, tr.ID, tr.FourCC, tr.Body, c.ids[i], c.fourccs[i], c.bodies[i])
+			}
+		}
+	}
+}
+
+func TestSplitTracksNotMultitrack(t *testing.T) {
+	for _, c := range []struct {
+		tagType flv.TagType
+		body    string
+	}{
+		{flv.TAG_TYPE_AUDIO, "af 01 2110"},
+		{flv.TAG_TYPE_VIDEO, "17 01 000000"},
+		{flv.TAG_TYPE_VIDEO, "91 61763031 0a"},
+		{flv.TAG_TYPE_META, "02 000a"},
+	} {
+		if tracks, err := SplitTracks(c.tagType, hexBytes(c.body)); tracks != nil || err != nil {
+			t.Errorf("SplitTracks(%s) = %v, %v, want no tracks", c.body, tracks, err)
+		}
+	}
+}
+
+func TestSplitTracksShort(t *testing.T) {
+	for _, c := range []struct {
+		tagType flv.TagType
+		body    string
+	}{
+		{flv.TAG_TYPE_AUDIO, "95"},
+		{flv.TAG_TYPE_AUDIO, "95 11 4f70"},
+		{flv.TAG_TYPE_AUDIO, "95 11 4f707573 00 0000"},
+		{flv.TAG_TYPE_AUDIO, "95 11 4f707573 00 000003 aabb"},
+		{flv.TAG_TYPE_VIDEO, "96 21 00 6176"},
+	} {
+		if _, err := SplitTracks(c.tagType, hexBytes(c.body)); err == nil {
+			t.Errorf("SplitTracks(%s) did not fail", c.body)
+		}
+	}
+}
+
+func TestTracksFilter(t *testing.T) {
+	body := hexBytes("95 11 4f707573 00 000002 aabb 01 000001 cc")
+	in := flv.AudioFrame{CFrame: &flv.CFrame{Stream: 0, Dts: 40, Type: flv.TAG_TYPE_AUDIO, Flavor: flv.FRAME, Body: body}}
+	f := &tracksFilter{types: map[flv.TagType]bool{flv.TAG_TYPE_AUDIO: true}}
+	out, err := f.Filter(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 {
+		t.Fatalf("%d frames, want 2", len(out))
+	}
+	for i, want := range []string{"91 4f707573 aabb", "91 4f707573 cc"} {
+		fr := out[i]
+		if fr.GetStream() != uint32(i) {
+			t.Errorf("frame %d has stream %d, want track id %d", i, fr.GetStream(), i)
+		}
+		// written tag is plain single-track tag of stream 0
+		w := untrack(fr)
+		if w.GetStream() != 0 || w.GetDts() != 40 || w.GetType() != flv.TAG_TYPE_AUDIO {
+			t.Errorf("frame %d is written as stream %d dts %d type %v", i, w.GetStream(), w.GetDts(), w.GetType())
+		}
+		if !bytes.Equal(*w.GetBody(), hexBytes(want)) {
+			t.Errorf("frame %d body % x, want %s", i, *w.GetBody(), want)
+		}
+	}
+	// dts changed by later stages does not leak to other tracks or input
+	out[0].SetDts(10)
+	if out[1].GetDts() != 40 || in.GetDts() != 40 {
+		t.Errorf("frames share dts: %d, %d", out[1].GetDts(), in.GetDts())
+	}
+	if !bytes.Equal(*in.GetBody(), body) {
+		t.Errorf("input body changed to % x", *in.GetBody())
+	}
+
+	legacy := testVideoFrame(1, 80, true)
+	if out, err := f.Filter(legacy); err != nil || len(out) != 1 || out[0] != legacy {
+		t.Errorf("video frame is not passed as it is: %v, %v", out, err)
+	}
+}
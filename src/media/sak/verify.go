@@ -0,0 +1,199 @@
+package sak
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/metachord/amf.go/amf0"
+	"github.com/metachord/flv.go/flv"
+	"io"
+	"math"
+)
+
+// maxDurationDiff is difference in seconds of duration of onMetaData and
+// scanned one still counted as match: tools disagree on length of the last
+// frame.
+const maxDurationDiff = 0.1
+
+// VerifyIndex checks the first onMetaData of inFile against the file. Every
+// keyframes.filepositions entry must point to video keyframe with dts of
+// matching keyframes.times entry, or to audio tag when hasKeyframes is false
+// (index of audio-only file). duration must match the file as well,
+// filesize and datasize, when present, must match the file by one of
+// definitions tools agree on: filesize is length of the file, datasize is
+// sum of tag bodies or of whole tags, with or without onMetaData tags, see
+// scanStats.dataSizes. Problems are printed to w, MetadataError is returned when
+// there are any.
+func (j *Job) VerifyIndex(inFile string, w io.Writer) (err error) {
+	j.reset()
+	defer j.end(&err)
+
+	r, err := OpenReader(inFile)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	j.header = r.Header
+
+	meta, metaLoc, err := j.readOnMetaData(r)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		return &MetadataError{fileLocation(inFile), errors.New("no onMetaData")}
+	}
+
+	problems := 0
+	report := func(format string, v ...interface{}) {
+		problems++
+		fmt.Fprintf(w, format+"\n", v...)
+	}
+
+	times, positions, err := keyframesIndex(meta)
+	if err != nil {
+		report("%s: %s", metaLoc, err)
+	}
+	fi, err := r.InFile.Stat()
+	if err != nil {
+		return &InputError{fileLocation(inFile), err}
+	}
+	audioIndex := meta["hasKeyframes"] == amf0.BooleanType(false)
+	for i := range positions {
+		p := positions[i]
+		if math.IsNaN(p) || math.IsInf(p, 0) || p < 0 || p >= float64(fi.Size()) || p != math.Trunc(p) {
+			report("keyframes[%d]: invalid position %v, file has %d bytes", i, p, fi.Size())
+			continue
+		}
+		if err := r.SeekTag(int64(p)); err != nil {
+			return err
+		}
+		frame, rerr := r.ReadFrame()
+		if rerr != nil || frame == nil {
+			report("keyframes[%d]: no tag at position %.0f", i, positions[i])
+			continue
+		}
+		switch {
+		case audioIndex && frame.GetType() == flv.TAG_TYPE_AUDIO:
+		case audioIndex:
+			report("keyframes[%d]: tag at position %.0f is not audio", i, positions[i])
+			continue
+		case !isKeyFrame(frame):
+			report("keyframes[%d]: tag at position %.0f is not video keyframe", i, positions[i])
+			continue
+		}
+		if dts := float64(frame.GetDts()); math.Abs(dts-times[i]*1000) > 1 {
+			report("keyframes[%d]: tag at position %.0f has dts %.0f, times has %.3f", i, positions[i], dts, times[i])
+		}
+	}
+
+	// the file as it is: positions and sizes of onMetaData in place
+	if err = r.Rewind(); err != nil {
+		return err
+	}
+	j.inPlace = true
+	scanned, stats, err := j.createMeta(r)
+	if err != nil {
+		return err
+	}
+	// audio index depends on interval, it can not be checked for missing
+	// entries
+	if kfs, ok := (*scanned)["keyframes"].(*amf0.ObjectType); ok {
+		if fp, ok := (*kfs)["filepositions"].(*amf0.StrictArrayType); ok && len(*fp) != len(positions) && !audioIndex {
+			report("keyframes: %d entries, file has %d", len(positions), len(*fp))
+		}
+	}
+	if got, ok := meta["filesize"].(amf0.NumberType); ok {
+		if want, _ := (*scanned)["filesize"].(amf0.NumberType); got != want {
+			report("filesize: %v, file has %v", got, want)
+		}
+	}
+	if got, ok := meta["datasize"].(amf0.NumberType); ok {
+		if !containsSize(stats.dataSizes(), float64(got)) {
+			want, _ := (*scanned)["datasize"].(amf0.NumberType)
+			report("datasize: %v, file has %v", got, want)
+		}
+	}
+	want, _ := (*scanned)["duration"].(amf0.NumberType)
+	if got, ok := meta["duration"].(amf0.NumberType); !ok {
+		report("duration: missing, file has %v", want)
+	} else if math.Abs(float64(got-want)) > maxDurationDiff {
+		report("duration: %v, file has %v", got, want)
+	}
+
+	if problems > 0 {
+		return &MetadataError{metaLoc, fmt.Errorf("%d problems of onMetaData found", problems)}
+	}
+	fmt.Fprintf(w, "keyframes index of %d entries is valid\n", len(positions))
+	return nil
+}
+
+// readOnMetaData returns values of the first onMetaData tag of r and its
+// location, nil if there is none.
+func (j *Job) readOnMetaData(r *Reader) (meta map[amf0.StringType]interface{}, loc Location, err error) {
+	for {
+		frame, err := j.readFrame(r)
+		if err != nil {
+			return nil, loc, err
+		}
+		if frame == nil {
+			return nil, loc, nil
+		}
+		if frame.GetType() != flv.TAG_TYPE_META {
+			continue
+		}
+		dec := amf0.NewDecoder(bytes.NewReader(*frame.GetBody()))
+		if ev, err := dec.Decode(); err != nil || ev != amf0.StringType("onMetaData") {
+			continue
+		}
+		md, err := dec.Decode()
+		if err != nil {
+			return nil, loc, &MetadataError{r.Location(), err}
+		}
+		switch md := md.(type) {
+		case *amf0.EcmaArrayType:
+			return *md, r.Location(), nil
+		case *amf0.ObjectType:
+			return *md, r.Location(), nil
+		}
+		return nil, loc, &MetadataError{r.Location(), errors.New("onMetaData is not object")}
+	}
+}
+
+// keyframesIndex returns times and filepositions of keyframes object of
+// onMetaData.
+func keyframesIndex(meta map[amf0.StringType]interface{}) (times, positions []float64, err error) {
+	var kfs map[amf0.StringType]interface{}
+	switch v := meta["keyframes"].(type) {
+	case *amf0.ObjectType:
+		kfs = *v
+	case *amf0.EcmaArrayType:
+		kfs = *v
+	default:
+		return nil, nil, errors.New("no keyframes object")
+	}
+	numbers := func(key amf0.StringType) ([]float64, error) {
+		arr, ok := kfs[key].(*amf0.StrictArrayType)
+		if !ok {
+			return nil, fmt.Errorf("no keyframes.%s array", key)
+		}
+		out := make([]float64, len(*arr))
+		for i, e := range *arr {
+			n, ok := e.(amf0.NumberType)
+			if !ok {
+				return nil, fmt.Errorf("keyframes.%s[%d] is not number", key, i)
+			}
+			out[i] = float64(n)
+		}
+		return out, nil
+	}
+	if times, err = numbers("times"); err != nil {
+		return nil, nil, err
+	}
+	if positions, err = numbers("filepositions"); err != nil {
+		return nil, nil, err
+	}
+	if len(times) != len(positions) {
+		return nil, nil, fmt.Errorf("keyframes has %d times and %d filepositions", len(times), len(positions))
+	}
+	return times, positions, nil
+}
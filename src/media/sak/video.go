@@ -0,0 +1,317 @@
+package sak
+
+import (
+	"errors"
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+)
+
+// Video frame types of FLV video tag.
+const (
+	VideoFrameKey          = 1
+	VideoFrameInter        = 2
+	VideoFrameDisposable   = 3
+	VideoFrameGeneratedKey = 4
+	VideoFrameCommand      = 5
+)
+
+// Enhanced RTMP video packet types.
+const (
+	VideoPacketSequenceStart        = 0
+	VideoPacketCodedFrames          = 1
+	VideoPacketSequenceEnd          = 2
+	VideoPacketCodedFramesX         = 3
+	VideoPacketMetadata             = 4
+	VideoPacketMPEG2TSSequenceStart = 5
+	VideoPacketMultitrack           = 6
+	VideoPacketModEx                = 7
+)
+
+// Enhanced RTMP multitrack types.
+const (
+	multitrackOneTrack   = 0
+	multitrackManyTracks = 1
+	multitrackManyCodecs = 2
+)
+
+// Enhanced RTMP video codecs.
+const (
+	FourCCAVC  = "avc1"
+	FourCCHEVC = "hvc1"
+	FourCCAV1  = "av01"
+	FourCCVP9  = "vp09"
+)
+
+// legacy HEVC codec id used by some Chinese CDNs before Enhanced RTMP
+const videoCodecHEVC = 12
+
+// videoCodecNames maps legacy codec ids and FourCC to readable names.
+var videoCodecNames = map[string]string{
+	"1":        "JPEG",
+	"2":        "Sorenson H.263",
+	"3":        "Screen video",
+	"4":        "On2 VP6",
+	"5":        "On2 VP6 with alpha",
+	"6":        "Screen video v2",
+	"7":        "AVC",
+	"12":       "HEVC",
+	FourCCAVC:  "AVC",
+	FourCCHEVC: "HEVC",
+	FourCCAV1:  "AV1",
+	FourCCVP9:  "VP9",
+}
+
+// VideoTag is parsed header of FLV video tag, legacy or Enhanced RTMP.
+type VideoTag struct {
+	FrameType int
+	// Enhanced is true for tags with Enhanced RTMP extended header.
+	Enhanced bool
+	// CodecID is codec of legacy tag.
+	CodecID int
+	// FourCC is codec of Enhanced RTMP tag.
+	FourCC string
+	// PacketType is VideoPacketType of Enhanced RTMP tag or AVCPacketType
+	// of legacy AVC tag.
+	PacketType int
+	// CompositionTime is offset of presentation time from dts.
+	CompositionTime int32
+	// Data is codec payload following the header.
+	Data []byte
+	// Tracks is number of tracks of multitrack tag described by its first
+	// track, 0 for single-track tag.
+	Tracks int
+}
+
+// ParseVideoTag parses header of video tag body.
+func ParseVideoTag(body []byte) (t *VideoTag, err error) {
+	if len(body) < 1 {
+		return nil, errShortData
+	}
+	t = &VideoTag{FrameType: int(body[0]>>4) & 0x07}
+	if body[0]&0x80 == 0 {
+		t.CodecID = int(body[0] & 0x0f)
+		t.Data = body[1:]
+		if t.CodecID == videoCodecAVC || t.CodecID == videoCodecHEVC {
+			if len(body) < 5 {
+				return nil, errShortData
+			}
+			t.PacketType = int(body[1])
+			t.CompositionTime = si24(body[2:5])
+			t.Data = body[5:]
+		}
+		return t, nil
+	}
+
+	t.Enhanced = true
+	t.PacketType = int(body[0] & 0x0f)
+	pos := 1
+	if t.PacketType == VideoPacketModEx {
+		t.PacketType, pos, err = skipModEx(body, pos)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t.FrameType == VideoFrameCommand && t.PacketType != VideoPacketMetadata {
+		// VideoCommand follows instead of codec payload
+		t.Data = body[pos:]
+		return t, nil
+	}
+	if t.PacketType == VideoPacketMultitrack {
+		tracks, err := SplitTracks(flv.TAG_TYPE_VIDEO, body)
+		if err != nil {
+			return nil, err
+		}
+		// describe the first track
+		t, err = ParseVideoTag(tracks[0].Body)
+		if err != nil {
+			return nil, err
+		}
+		t.Tracks = len(tracks)
+		return t, nil
+	}
+	if len(body) < pos+4 {
+		return nil, errShortData
+	}
+	t.FourCC = string(body[pos : pos+4])
+	pos += 4
+	if t.PacketType == VideoPacketCodedFrames && (t.FourCC == FourCCAVC || t.FourCC == FourCCHEVC) {
+		if len(body) < pos+3 {
+			return nil, errShortData
+		}
+		t.CompositionTime = si24(body[pos : pos+3])
+		pos += 3
+	}
+	t.Data = body[pos:]
+	return t, nil
+}
+
+// Codec returns name of codec: FourCC of Enhanced RTMP tag or legacy codec id.
+func (t *VideoTag) Codec() string {
+	if t.Enhanced {
+		return t.FourCC
+	}
+	return fmt.Sprintf("%d", t.CodecID)
+}
+
+// CodecName returns codec id or FourCC followed by readable name, e.g.
+// "7 (AVC)".
+func (t *VideoTag) CodecName() string {
+	return codecName(t.Codec(), videoCodecNames)
+}
+
+func codecName(codec string, names map[string]string) string {
+	if name, ok := names[codec]; ok && name != codec {
+		return fmt.Sprintf("%s (%s)", codec, name)
+	}
+	return codec
+}
+
+// IsSequenceHeader reports whether tag carries decoder configuration.
+func (t *VideoTag) IsSequenceHeader() bool {
+	if t.Enhanced {
+		return t.PacketType == VideoPacketSequenceStart || t.PacketType == VideoPacketMPEG2TSSequenceStart
+	}
+	return (t.CodecID == videoCodecAVC || t.CodecID == videoCodecHEVC) && t.PacketType == avcSequenceHeader
+}
+
+// IsCodedFrame reports whether tag carries video frame.
+func (t *VideoTag) IsCodedFrame() bool {
+	if t.FrameType == VideoFrameCommand {
+		return false
+	}
+	if t.Enhanced {
+		return t.PacketType == VideoPacketCodedFrames || t.PacketType == VideoPacketCodedFramesX
+	}
+	if t.CodecID == videoCodecAVC || t.CodecID == videoCodecHEVC {
+		return t.PacketType == avcNALU
+	}
+	return true
+}
+
+// IsKeyFrame reports whether tag carries video keyframe.
+func (t *VideoTag) IsKeyFrame() bool {
+	return t.FrameType == VideoFrameKey && t.IsCodedFrame()
+}
+
+// PacketName returns readable name of packet type.
+func (t *VideoTag) PacketName() string {
+	if !t.Enhanced {
+		if t.CodecID != videoCodecAVC && t.CodecID != videoCodecHEVC {
+			return ""
+		}
+		switch t.PacketType {
+		case avcSequenceHeader:
+			return "SequenceHeader"
+		case avcNALU:
+			return "NALU"
+		case avcEndOfSequence:
+			return "EndOfSequence"
+		}
+		return fmt.Sprintf("%d", t.PacketType)
+	}
+	switch t.PacketType {
+	case VideoPacketSequenceStart:
+		return "SequenceStart"
+	case VideoPacketCodedFrames:
+		return "CodedFrames"
+	case VideoPacketSequenceEnd:
+		return "SequenceEnd"
+	case VideoPacketCodedFramesX:
+		return "CodedFramesX"
+	case VideoPacketMetadata:
+		return "Metadata"
+	case VideoPacketMPEG2TSSequenceStart:
+		return "MPEG2TSSequenceStart"
+	}
+	return fmt.Sprintf("%d", t.PacketType)
+}
+
+// Dimensions returns picture size from sequence header of AVC, HEVC and AV1
+// or from VP9 keyframe.
+func (t *VideoTag) Dimensions() (width, height int, err error) {
+	codec := t.FourCC
+	if !t.Enhanced {
+		switch t.CodecID {
+		case videoCodecAVC:
+			codec = FourCCAVC
+		case videoCodecHEVC:
+			codec = FourCCHEVC
+		}
+	}
+	switch {
+	case codec == FourCCAVC && t.IsSequenceHeader():
+		sps, err := parseAVCSequenceHeader(t.Data)
+		if err != nil {
+			return 0, 0, err
+		}
+		return sps.Width, sps.Height, nil
+	case codec == FourCCHEVC && t.IsSequenceHeader():
+		return hevcDimensions(t.Data)
+	case codec == FourCCAV1 && t.IsSequenceHeader():
+		return av1Dimensions(t.Data)
+	case codec == FourCCVP9 && t.IsKeyFrame():
+		return vp9Dimensions(t.Data)
+	}
+	return 0, 0, errNoDimensions
+}
+
+var errNoDimensions = errors.New("no picture size in tag")
+
+// FourCCNumber returns FourCC as big endian 32-bit number, the way
+// Enhanced RTMP writes codec ids of onMetaData.
+func FourCCNumber(fourcc string) uint32 {
+	var n uint32
+	for i := 0; i < 4 && i < len(fourcc); i++ {
+		n = n<<8 | uint32(fourcc[i])
+	}
+	return n
+}
+
+func si24(b []byte) int32 {
+	v := int32(b[0])<<16 | int32(b[1])<<8 | int32(b[2])
+	if v&0x800000 != 0 {
+		v -= 0x1000000
+	}
+	return v
+}
+
+// skipModEx skips ModEx data of Enhanced RTMP tag starting at pos and
+// returns packet type following it. ModEx is packet type 7 for both audio
+// and video.
+func skipModEx(body []byte, pos int) (packetType, next int, err error) {
+	for {
+		if len(body) < pos+1 {
+			return 0, 0, errShortData
+		}
+		size := int(body[pos]) + 1
+		pos++
+		if size == 256 {
+			if len(body) < pos+2 {
+				return 0, 0, errShortData
+			}
+			size = (int(body[pos])<<8 | int(body[pos+1])) + 1
+			pos += 2
+		}
+		pos += size
+		if len(body) < pos+1 {
+			return 0, 0, errShortData
+		}
+		packetType = int(body[pos] & 0x0f)
+		pos++
+		if packetType != VideoPacketModEx {
+			return packetType, pos, nil
+		}
+	}
+}
+
+// videoTag parses header of video frame, nil for other frames or bad data.
+func videoTag(frame flv.Frame) *VideoTag {
+	if frame.GetType() != flv.TAG_TYPE_VIDEO {
+		return nil
+	}
+	t, err := ParseVideoTag(*frame.GetBody())
+	if err != nil {
+		return nil
+	}
+	return t
+}
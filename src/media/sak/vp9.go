@@ -0,0 +1,47 @@
+package sak
+
+import (
+	"errors"
+)
+
+const vp9ColorSpaceRGB = 7
+
+var errNotVP9Keyframe = errors.New("not a VP9 keyframe")
+
+// vp9Dimensions returns frame size from uncompressed header of VP9 keyframe.
+func vp9Dimensions(frame []byte) (width, height int, err error) {
+	br := newBitReader(frame)
+	if br.bits(2) != 2 { // frame_marker
+		return 0, 0, errors.New("bad VP9 frame marker")
+	}
+	profile := int(br.bit())
+	profile |= int(br.bit()) << 1
+	if profile == 3 {
+		br.bit() // reserved_zero
+	}
+	if br.bit() == 1 || br.bit() != 0 { // show_existing_frame, frame_type
+		return 0, 0, errNotVP9Keyframe
+	}
+	br.bit() // show_frame
+	br.bit() // error_resilient_mode
+	if br.bits(24) != 0x498342 {
+		return 0, 0, errors.New("bad VP9 sync code")
+	}
+	if profile >= 2 {
+		br.bit() // ten_or_twelve_bit
+	}
+	if br.bits(3) != vp9ColorSpaceRGB {
+		br.bit() // color_range
+		if profile == 1 || profile == 3 {
+			br.bits(3) // subsampling_x, subsampling_y, reserved_zero
+		}
+	} else if profile == 1 || profile == 3 {
+		br.bit() // reserved_zero
+	}
+	width = int(br.bits(16)) + 1
+	height = int(br.bits(16)) + 1
+	if br.err != nil {
+		return 0, 0, br.err
+	}
+	return width, height, nil
+}
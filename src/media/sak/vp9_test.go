@@ -0,0 +1,26 @@
+package sak
+
+import (
+	"testing"
+)
+
+func TestVP9Dimensions(t *testing.T) {
+	// uncompressed header of libvpx 320x240 profile 0 keyframe
+	data := hexBytes("82 49 83 42 00 13 f0 0e f6 00")
+	w, h, err := vp9Dimensions(data)
+	if err != nil || w != 320 || h != 240 {
+		t.Errorf("got %dx%d, %v", w, h, err)
+	}
+	for n := 0; n < 9; n++ {
+		if _, _, err := vp9Dimensions(data[:n]); err == nil {
+			t.Errorf("cut to %d bytes: no error", n)
+		}
+	}
+	// inter frame
+	if _, _, err := vp9Dimensions(hexBytes("86 00 40 92 88 2c")); err != errNotVP9Keyframe {
+		t.Errorf("inter frame: %v", err)
+	}
+	if _, _, err := vp9Dimensions(hexBytes("82 49 83 43 00 13 f0 0e f6 00")); err == nil {
+		t.Error("bad sync code: no error")
+	}
+}